@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -13,7 +14,6 @@ import (
 
 	"github.com/benjamincjackson/ash/pkg/ancestry"
 	"github.com/benjamincjackson/ash/pkg/annotation"
-	"github.com/benjamincjackson/ash/pkg/bitsets"
 	"github.com/benjamincjackson/ash/pkg/characterio"
 	"github.com/benjamincjackson/ash/pkg/epistasis"
 	"github.com/benjamincjackson/ash/pkg/paper"
@@ -39,7 +39,7 @@ func morethanone(ba ...bool) bool {
 // to do possibly - sanity check arguments if --civet is given
 func checkArgs(treeFile string, alignmentFile string, variantsConfig string, genbankFile string, tipFile string,
 	algorithmUp string, algorithmDown string, treeOut string,
-	civet bool, nuc bool, p bool, epi bool, common_anc bool) (int, int, string, string, error) {
+	civet bool, nuc bool, p bool, epi bool, common_anc bool, segmentsFile string, insertionsOut string, matFile string, nodeDataFiles []string) (int, int, string, string, error) {
 
 	algoUp := -1
 	switch algorithmUp {
@@ -100,9 +100,17 @@ func checkArgs(treeFile string, alignmentFile string, variantsConfig string, gen
 		s := bufio.NewScanner(f)
 		for s.Scan() {
 			line := s.Text()
+			if len(line) == 0 {
+				continue
+			}
+			// anything that isn't a nucleotide variant (including named mutations in genes) needs the annotation
 			fields := strings.Split(line, ":")
-			if fields[0] == "aa" {
+			switch fields[0] {
+			case "nuc", "del", "mnv", "ins":
+			default:
 				aa = true
+			}
+			if aa {
 				break
 			}
 		}
@@ -115,9 +123,41 @@ func checkArgs(treeFile string, alignmentFile string, variantsConfig string, gen
 		}
 	}
 
+	if len(segmentsFile) > 0 {
+		if len(alignmentFile) > 0 || len(genbankFile) > 0 || len(tipFile) > 0 {
+			return algoUp, algoDown, "", "", errors.New("--segments replaces --alignment and --genbank (and can't be used with a --tipfile)")
+		}
+		if preset == "none" || len(variantsConfig) > 0 {
+			return algoUp, algoDown, "", "", errors.New("--segments can only be used with a preset that types every site (e.g. --civet or --nuc), not a --config")
+		}
+		if len(insertionsOut) > 0 {
+			return algoUp, algoDown, "", "", errors.New("--insertions-out can't be used with --segments: it is for the insertions in one --alignment")
+		}
+	}
+
+	if len(matFile) > 0 {
+		if len(treeFile) > 0 || len(alignmentFile) > 0 || len(tipFile) > 0 || len(segmentsFile) > 0 {
+			return algoUp, algoDown, "", "", errors.New("--mat replaces --treefile and --alignment (and can't be used with a --tipfile or --segments)")
+		}
+		if preset == "none" {
+			return algoUp, algoDown, "", "", errors.New("--mat can only be used with a preset that types every site (e.g. --civet or --nuc)")
+		}
+	}
+
+	if len(nodeDataFiles) > 0 && len(matFile) > 0 {
+		return algoUp, algoDown, "", "", errors.New("--node-data is for a newick --treefile, not --mat")
+	}
+
 	var s string
-	if len(alignmentFile) > 0 {
+	if len(matFile) > 0 {
+		s = "mat"
+	} else if len(segmentsFile) > 0 {
+		s = "segments"
+	} else if len(alignmentFile) > 0 {
 		s = "alignment"
+	} else if len(tipFile) == 0 && (strings.ToLower(filepath.Ext(treeFile)) == ".json" || len(nodeDataFiles) > 0) {
+		// a Nextstrain build's traits (or its mutations, for the presets that type every site)
+		s = "nextstrain"
 	} else {
 		s = "csv"
 	}
@@ -125,20 +165,37 @@ func checkArgs(treeFile string, alignmentFile string, variantsConfig string, gen
 	return algoUp, algoDown, s, preset, nil
 }
 
-func readTree(treeFile string) (*tree.Tree, error) {
+// read the tree: a newick file, or an Auspice v2 JSON (.json). What we can use from a Nextstrain build (the traits and
+// mutations of the nodes, and the root sequence) comes back as NodeData, from the Auspice JSON or from augur node-data files
+func readTree(treeFile string, nodeDataFiles []string, traits []string) (*tree.Tree, characterio.NodeData, error) {
 	var t *tree.Tree
-	var f *os.File
+	var data characterio.NodeData
 	var err error
 
-	f, err = os.Open(treeFile)
-	defer f.Close()
-	if err != nil {
-		return new(tree.Tree), err
+	if strings.ToLower(filepath.Ext(treeFile)) == ".json" {
+		t, data, err = characterio.ReadAuspice(treeFile, traits)
+		if err != nil {
+			return new(tree.Tree), data, err
+		}
+	} else {
+		var f *os.File
+		f, err = os.Open(treeFile)
+		defer f.Close()
+		if err != nil {
+			return new(tree.Tree), data, err
+		}
+
+		t, err = newick.NewParser(f).Parse()
+		if err != nil {
+			return new(tree.Tree), data, err
+		}
 	}
 
-	t, err = newick.NewParser(f).Parse()
-	if err != nil {
-		return new(tree.Tree), err
+	if len(nodeDataFiles) > 0 {
+		data, err = characterio.ReadNodeData(t, nodeDataFiles, data, traits)
+		if err != nil {
+			return new(tree.Tree), data, err
+		}
 	}
 
 	// we find the max depth for each node, 'cos we want to sort on it
@@ -150,7 +207,197 @@ func readTree(treeFile string) (*tree.Tree, error) {
 	// Must update(/initiate?) the tip index so we can map the character states for the tips straight to the tree
 	t.UpdateTipIndex()
 
-	return t, nil
+	return t, data, nil
+}
+
+// get the regions of the genome from the genbank (or GFF3) file, or for a multi-segment genome, from each segment's
+// annotation, in the coordinates of the concatenated segments. The features in any BED files are attached to
+// the regions too (for a multi-segment genome, to the segment with the same name as their chrom). Unless featureLabels
+// is set, the regions have no features, so changes aren't labelled with the names of the features they are in
+func getRegions(genbankFile string, gffFasta string, segments []characterio.Segment, nuc bool, geneticCode int, matPeptides bool, naming annotation.CDSNaming, bedFiles []string, featureLabels bool) ([]annotation.Region, error) {
+
+	regions, err := getAnnotatedRegions(genbankFile, gffFasta, segments, nuc, geneticCode, matPeptides, naming, bedFiles)
+	if err != nil || featureLabels {
+		return regions, err
+	}
+	for i := range regions {
+		regions[i].Features = nil
+	}
+	return regions, nil
+}
+
+// get the regions of the genome, with the non-coding features of the annotation and the features in the BED files
+func getAnnotatedRegions(genbankFile string, gffFasta string, segments []characterio.Segment, nuc bool, geneticCode int, matPeptides bool, naming annotation.CDSNaming, bedFiles []string) ([]annotation.Region, error) {
+
+	bedFeatures := make([]annotation.Feature, 0)
+	for _, bedFile := range bedFiles {
+		features, err := annotation.ReadBED(bedFile)
+		if err != nil {
+			return make([]annotation.Region, 0), err
+		}
+		bedFeatures = append(bedFeatures, features...)
+	}
+
+	if len(segments) == 0 {
+		regions, err := annotation.GetRegions(genbankFile, gffFasta, nuc, geneticCode, matPeptides, naming)
+		if err != nil {
+			return make([]annotation.Region, 0), err
+		}
+		annotation.AttachFeatures(regions, bedFeatures)
+		return regions, nil
+	}
+
+	regions := make([]annotation.Region, 0)
+	for _, segment := range segments {
+		segRegions, err := annotation.GetRegions(segment.Genbank, segment.Fasta, nuc, geneticCode, matPeptides, naming)
+		if err != nil {
+			return make([]annotation.Region, 0), err
+		}
+		segFeatures := make([]annotation.Feature, 0)
+		for _, F := range bedFeatures {
+			if F.Chrom == segment.Name {
+				segFeatures = append(segFeatures, F)
+			}
+		}
+		annotation.AttachFeatures(segRegions, segFeatures)
+		regions = append(regions, annotation.OffsetRegions(segRegions, segment.Name, segment.Offset)...)
+	}
+	return regions, nil
+}
+
+// print the CDSs in the annotation (or in each segment's annotation), with their resolved names, as a TSV
+func listCDSs(genbankFile string, gffFasta string, segmentsFile string, geneticCode int, naming annotation.CDSNaming) error {
+
+	segments := make([]characterio.Segment, 0)
+	if len(segmentsFile) > 0 {
+		var err error
+		segments, err = characterio.ReadSegments(segmentsFile)
+		if err != nil {
+			return err
+		}
+	} else if len(genbankFile) == 0 {
+		return errors.New("you must provide a --genbank file (or --segments) to list its CDSs")
+	}
+
+	regions, err := getRegions(genbankFile, gffFasta, segments, false, geneticCode, false, naming, []string{}, false)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("name\tsegment\tstart\tstop\tstrand\ttransl_table\tcodons")
+	for _, r := range regions {
+		if r.Whichtype != "CDS" {
+			continue
+		}
+		strand := "+"
+		if r.Complement {
+			strand = "-"
+		}
+		fmt.Println(r.Name + "\t" + r.Segment + "\t" + strconv.Itoa(r.Start) + "\t" + strconv.Itoa(r.Stop) + "\t" + strand + "\t" + strconv.Itoa(r.TranslTable) + "\t" + strconv.Itoa(len(r.Codons)))
+	}
+
+	return nil
+}
+
+// set the masked sites to missing data, then mask or prune the tips that are missing more than maxMissingFraction of
+// the (unmasked) characters, and report what was masked and why to maskReport (or stderr)
+func mask(t *tree.Tree, characterStates []characterio.CharacterStruct, idx []characterio.StartStop, states [][]byte, segments []characterio.Segment,
+	maskFiles []string, maxMissingFraction float64, missingTips string, maskReport string) (*tree.Tree, [][]byte, error) {
+
+	sites := make([]characterio.MaskedSite, 0)
+	for _, maskFile := range maskFiles {
+		s, err := characterio.ReadMaskSites(maskFile)
+		if err != nil {
+			return t, states, err
+		}
+		sites = append(sites, s...)
+	}
+
+	report, err := characterio.MaskSites(states, idx, characterStates, segments, sites)
+	if err != nil {
+		return t, states, err
+	}
+
+	// the fraction of missing data is of the characters that are left
+	masked := make(map[string]bool)
+	for _, r := range report {
+		masked[r.Name] = true
+	}
+	unmasked := make([]characterio.StartStop, 0)
+	for i := range characterStates {
+		if !masked[characterStates[i].Name] {
+			unmasked = append(unmasked, idx[i])
+		}
+	}
+
+	tips := make([]string, 0)
+	if len(unmasked) > 0 {
+		fractions := characterio.MissingFractions(t, states, unmasked)
+		for _, tip := range t.AllTipNames() {
+			if fractions[tip] > maxMissingFraction {
+				tips = append(tips, tip)
+				report = append(report, characterio.MaskReport{What: "tip", Name: tip,
+					Reason: "missing " + strconv.FormatFloat(fractions[tip], 'f', 4, 64) + " of sites (" + missingTips + ")"})
+			}
+		}
+	}
+
+	switch missingTips {
+	case "mask":
+		err = characterio.MaskTips(t, states, tips)
+	case "prune":
+		t, states, err = characterio.PruneTips(t, states, tips)
+		// pruning can leave the root with one child, whose children are then the root's
+		if err == nil && !t.Rooted() {
+			err = errors.New("the tree is not rooted after pruning the tips with missing data")
+		}
+	}
+	if err != nil {
+		return t, states, err
+	}
+
+	f := os.Stderr
+	if len(maskReport) > 0 {
+		f, err = os.Create(maskReport)
+		if err != nil {
+			return t, states, err
+		}
+		defer f.Close()
+	}
+	err = characterio.WriteMaskReport(f, report)
+
+	return t, states, err
+}
+
+// get the sequence of the annotation, or for a multi-segment genome of each segment's annotation, for the reference
+// of a mutation-annotated tree
+func referenceSequences(genbankFile string, gffFasta string, segments []characterio.Segment) ([][]byte, error) {
+	if len(segments) == 0 {
+		gb, err := annotation.ReadAnnotation(genbankFile, gffFasta)
+		if err != nil {
+			return [][]byte{}, err
+		}
+		return [][]byte{gb.ORIGIN}, nil
+	}
+	references := make([][]byte, 0)
+	for _, segment := range segments {
+		gb, err := annotation.ReadAnnotation(segment.Genbank, segment.Fasta)
+		if err != nil {
+			return [][]byte{}, err
+		}
+		references = append(references, gb.ORIGIN)
+	}
+	return references, nil
+}
+
+// create a fasta file of ancestral sequences, and write them to it
+func writeAncestralFasta(filename string, write func(f *os.File) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return write(f)
 }
 
 // func getRealSizeOf(v interface{}) (int, error) {
@@ -161,28 +408,82 @@ func readTree(treeFile string) (*tree.Tree, error) {
 // 	return b.Len(), nil
 // }
 
-func ash(treeIn string, alignmentFile string, variantsConfig string, genbankFile string, tipFile string,
-	algorithmUp string, algorithmDown string, annotateNodes bool, annotateTips bool, threshold int,
-	treeOut string, childrenOut string,
-	summarize bool, civet bool, nuc bool, p bool, epi bool, common_anc bool, outgroup string, rescale bool,
-	threads int) error {
+func ash(o options) error {
 
 	// algoUp, algoDown, input, err := checkArgs(treeIn, alignmentFile, variantsConfig, genbankFile, tipFile, algorithmUp, algorithmDown, treeOut)
-	algoUp, algoDown, input, preset, err := checkArgs(treeIn, alignmentFile, variantsConfig, genbankFile, tipFile, algorithmUp, algorithmDown, treeOut, civet, nuc, p, epi, common_anc)
+	algoUp, algoDown, input, preset, err := checkArgs(o.treeFile, o.alignmentFile, o.variantsConfig, o.genbankFile, o.tipFile, o.algorithmUp, o.algorithmDown, o.treeOut, o.civet, o.nuc, o.p, o.epi, o.common_anc, o.segmentsFile, o.insertionsOut, o.matFile, o.nodeDataFiles)
 	if err != nil {
 		return err
 	}
 
-	/*
-		read in the tree
-	*/
-	t, err := readTree(treeIn)
+	err = annotation.ValidGeneticCode(o.geneticCode)
 	if err != nil {
 		return err
 	}
 
-	if !t.Rooted() {
-		return errors.New("the input tree is not rooted")
+	if o.aaNumbering != "cds" && o.aaNumbering != "peptide" {
+		return errors.New("unknown --aa-numbering: choose one of cds or peptide")
+	}
+
+	err = o.naming.Check()
+	if err != nil {
+		return err
+	}
+
+	if len(o.bedFiles) > 0 && !o.featureLabels {
+		return errors.New("--bed can only be used with --feature-labels")
+	}
+
+	if len(o.matOut) > 0 && (preset == "none" || input == "csv") {
+		return errors.New("--mat-out can only be used with an --alignment (or --segments) and a preset that types every site (e.g. --civet or --nuc)")
+	}
+
+	if len(o.nodeDataOut) > 0 && (preset == "none" || input == "csv") {
+		return errors.New("--node-data-out can only be used with an --alignment (or --segments) and a preset that types every site (e.g. --civet or --nuc)")
+	}
+
+	if (len(o.ancestralFastaOut) > 0 || len(o.ancestralAAFastaOut) > 0) && (preset == "none" || input == "csv") {
+		return errors.New("--ancestral-fasta-out and --ancestral-aa-fasta-out can only be used with a preset that types every site (e.g. --civet or --nuc)")
+	}
+
+	if o.ancestralMode != "iupac" && o.ancestralMode != "resolved" {
+		return errors.New("unknown --ancestral-mode: choose one of iupac or resolved")
+	}
+
+	if len(o.childrenOut) > 0 && preset != "none" {
+		return errors.New("--children-out can't be used with a preset - it lists the tips below the transitions of a --tipfile or --config's characters")
+	}
+
+	if len(o.childrenMetadata) > 0 && len(o.childrenOut) == 0 {
+		return errors.New("--children-metadata is for joining to --children-out")
+	}
+
+	if o.nodeStatesFormat != "wide" && o.nodeStatesFormat != "long" {
+		return errors.New("unknown --node-states-format: choose one of wide or long")
+	}
+
+	if o.missingTips != "mask" && o.missingTips != "prune" {
+		return errors.New("unknown --missing-tips: choose one of mask or prune")
+	}
+
+	if o.maxMissingFraction < 0 || o.maxMissingFraction > 1 {
+		return errors.New("--max-missing-fraction must be between 0 and 1")
+	}
+
+	/*
+		read in the tree (a mutation-annotated tree is read with its tips' states, below)
+	*/
+	var t *tree.Tree
+	var nodeData characterio.NodeData
+	if input != "mat" {
+		t, nodeData, err = readTree(o.treeFile, o.nodeDataFiles, o.traits)
+		if err != nil {
+			return err
+		}
+
+		if !t.Rooted() {
+			return errors.New("the input tree is not rooted")
+		}
 	}
 
 	/*
@@ -192,24 +493,93 @@ func ash(treeIn string, alignmentFile string, variantsConfig string, genbankFile
 	var idx []characterio.StartStop
 	var states [][]byte
 
+	// for multi-segment genomes, each segment has its own alignment and annotation
+	var segments []characterio.Segment
+
+	// if the alignment keeps insertions relative to a reference, we type it in reference coordinates
+	var coords *characterio.RefCoords
+	if len(o.referenceID) > 0 && input == "alignment" {
+		coords, err = characterio.GetRefCoords(o.alignmentFile, o.referenceID)
+		if err != nil {
+			return err
+		}
+	}
+
 	// to do - incorporate the civet/nuc presets into the logic here?
 	switch input {
 	case "alignment":
 		switch preset {
 		case "none":
-			characterStates, idx, states, err = characterio.TypeAlignment(t, alignmentFile, variantsConfig, genbankFile)
+			characterStates, idx, states, err = characterio.TypeAlignment(t, o.alignmentFile, o.variantsConfig, o.genbankFile, o.gffFasta, o.geneticCode, o.naming, coords)
+			if err != nil {
+				return err
+			}
+		default:
+			characterStates, idx, states, err = characterio.TypeAlignmentNuc(t, o.alignmentFile, coords)
 			if err != nil {
 				return err
 			}
+			if coords != nil && len(o.insertionsOut) > 0 {
+				err = characterio.WriteInsertions(o.insertionsOut, coords)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case "segments":
+		segments, err = characterio.ReadSegments(o.segmentsFile)
+		if err != nil {
+			return err
+		}
+		characterStates, idx, states, err = characterio.TypeSegmentsNuc(t, segments, o.referenceID)
+		if err != nil {
+			return err
+		}
+	case "mat":
+		var reference []byte
+		if len(o.matReference) > 0 {
+			reference, err = characterio.ReadReferenceFasta(o.matReference)
+		} else {
+			var references [][]byte
+			references, err = referenceSequences(o.genbankFile, o.gffFasta, segments)
+			if err == nil {
+				reference = references[0]
+			}
+		}
+		if err != nil {
+			return err
+		}
+		t, characterStates, idx, states, err = characterio.ReadMAT(o.matFile, reference)
+		if err != nil {
+			return err
+		}
+	case "nextstrain":
+		switch preset {
+		case "none":
+			characterStates, idx, states, err = characterio.TypeTraits(t, nodeData, o.traits)
 		default:
-			characterStates, idx, states, err = characterio.TypeAlignmentNuc(t, alignmentFile)
+			// the tips' sequences are the root's with the mutations on the way to them applied
+			reference := []byte(nodeData.RootSequence)
+			if len(o.matReference) > 0 {
+				reference, err = characterio.ReadReferenceFasta(o.matReference)
+			} else if len(reference) == 0 && len(o.genbankFile) > 0 {
+				var references [][]byte
+				references, err = referenceSequences(o.genbankFile, o.gffFasta, segments)
+				if err == nil {
+					reference = references[0]
+				}
+			}
 			if err != nil {
 				return err
 			}
+			characterStates, idx, states, err = characterio.TypeMutations(t, nodeData, reference)
+		}
+		if err != nil {
+			return err
 		}
 	case "csv":
 		// TO DO- in tipfile columns that contain nucleotide data, IUPAC codes are treated as non-overlapping states, e.g. W != (A & T), which is different from the same data in an alignment input
-		characterStates, idx, states, err = characterio.TypeTipfile(t, tipFile)
+		characterStates, idx, states, err = characterio.TypeTipfile(t, o.tipFile)
 		if err != nil {
 			return err
 		}
@@ -219,6 +589,13 @@ func ash(treeIn string, alignmentFile string, variantsConfig string, genbankFile
 
 	// TO DO- check all the tree's tips are in the character state input (we do the converse already when we read the character states in)
 
+	if len(o.maskFiles) > 0 || o.maxMissingFraction < 1 {
+		t, states, err = mask(t, characterStates, idx, states, segments, o.maskFiles, o.maxMissingFraction, o.missingTips, o.maskReport)
+		if err != nil {
+			return err
+		}
+	}
+
 	// TO DO- maybe just use the hard polytomies interpretation?
 	switch algoUp {
 	case 0: // hard polytomies
@@ -252,32 +629,56 @@ func ash(treeIn string, alignmentFile string, variantsConfig string, genbankFile
 	// 	fmt.Println(states[n.Id()])
 	// }
 
+	// the outputs that refer to internal nodes by name (the ancestral sequences and augur node-data) name the unnamed
+	// ones as augur refine does. They are named in the tree too, so that the --tree-out tree matches them. Otherwise the
+	// tree is written with the names it was read with
+	if len(o.ancestralFastaOut) > 0 || len(o.ancestralAAFastaOut) > 0 || len(o.nodeDataOut) > 0 {
+		names := characterio.NodeNames(t)
+		for _, n := range t.Nodes() {
+			n.SetName(names[n.Id()])
+		}
+	}
+
+	// the internal nodes to write the sequences of
+	var ancestors []ancestry.Node
+	if len(o.ancestralFastaOut) > 0 || len(o.ancestralAAFastaOut) > 0 {
+		ancestors, err = ancestry.SelectNodes(t, o.ancestralNodes, o.ancestralMinTips)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the regions of the genome, for the presets that use the annotation
+	var regions []annotation.Region
+
 	switch preset {
 	case "civet":
 		// genbank annotation parsing:
-		features, err := annotation.GetRegions(genbankFile, nuc)
+		features, err := getRegions(o.genbankFile, o.gffFasta, segments, o.nuc, o.geneticCode, o.aaNumbering == "peptide", o.naming, o.bedFiles, o.featureLabels)
 		if err != nil {
 			return err
 		}
+		regions = features
 
 		parsimony.LabelChangesAnno(t, features, characterStates, states)
 
-		if len(treeOut) > 0 {
-			fout, err := os.Create(treeOut)
+		if len(o.treeOut) > 0 {
+			fout, err := os.Create(o.treeOut)
 			if err != nil {
 				return err
 			}
 			defer fout.Close()
 
-			fout.WriteString(t.NexusOptionalComments(annotateNodes, annotateTips))
+			fout.WriteString(t.NexusOptionalComments(o.annotateNodes, o.annotateTips))
 		}
 
 	case "nuc":
 		// genbank annotation parsing:
-		features, err := annotation.GetRegions(genbankFile, nuc)
+		features, err := getRegions(o.genbankFile, o.gffFasta, segments, o.nuc, o.geneticCode, o.aaNumbering == "peptide", o.naming, o.bedFiles, o.featureLabels)
 		if err != nil {
 			return err
 		}
+		regions = features
 
 		parsimony.LabelChangesAnno(t, features, characterStates, states)
 
@@ -298,73 +699,53 @@ func ash(treeIn string, alignmentFile string, variantsConfig string, genbankFile
 		}
 
 		// rescale the tree for JT
-		if rescale {
+		if o.rescale {
 			for _, e := range t.Edges() {
 				e.SetLength(float64(len(e.GetComments())))
 			}
 		}
 
 		// write the treefile...
-		if len(treeOut) > 0 {
-			fout, err := os.Create(treeOut)
+		if len(o.treeOut) > 0 {
+			fout, err := os.Create(o.treeOut)
 			if err != nil {
 				return err
 			}
 			defer fout.Close()
 
 			// fout.WriteString(t.NewickOptionalComments(annotateNodes, annotateTips) + "\n")
-			fout.WriteString(t.NexusOptionalComments(annotateNodes, annotateTips))
+			fout.WriteString(t.NexusOptionalComments(o.annotateNodes, o.annotateTips))
 		}
 
 	case "common_anc":
 		// get the sequence at the node immediately ancestral to a set of samples
 		// first step is as for "nuc"
-		features, err := annotation.GetRegions(genbankFile, nuc)
+		features, err := getRegions(o.genbankFile, o.gffFasta, segments, o.nuc, o.geneticCode, o.aaNumbering == "peptide", o.naming, o.bedFiles, o.featureLabels)
 		if err != nil {
 			return err
 		}
+		regions = features
 
 		parsimony.LabelChangesAnno(t, features, characterStates, states)
 
 		// then get the ancestral node and print its sequence
-		commonAncNodeID, err := ancestry.MRCA(t, outgroup)
+		commonAncNodeID, err := ancestry.MRCA(t, o.outgroup)
 		// _, err = ancestry.MRCA(t, outgroup)
 		if err != nil {
 			return err
 		}
-		// for _, tip := range t.Tips() {
-		// 	fmt.Print(tip.Name() + " ")
-		// 	fmt.Println(states[tip.Id()])
-		// }
-		// for i := range characterStates {
-		// 	fmt.Println(characterStates[i])
-		// }
-		// for i := range characterStates {
-		// 	fmt.Println(bitsets.GetSetBits(states[commonAncNodeID][i : i+1]))
-		// }
-		fmt.Println(">root")
-		IUPACMap := annotation.GetIUPACMap()
-		for i := range states[commonAncNodeID] {
-			setBits := bitsets.GetSetBits(states[commonAncNodeID][i : i+1])
-			nucstates := make([]string, 0)
-			for _, b := range setBits {
-				// fmt.Println(characterStates[i])
-				nucstates = append(nucstates, characterStates[i].StateKey[b-1])
-			}
-			sort.Strings(nucstates)
-			if nuc, ok := IUPACMap[strings.Join(nucstates, "")]; ok {
-				fmt.Print(nuc)
-			} else {
-				fmt.Print("N")
-			}
+		// for multi-segment genomes, we print one record per segment
+		err = ancestry.WriteFasta(os.Stdout, characterStates, states, segments, []ancestry.Node{{ID: commonAncNodeID, Name: "root"}})
+		if err != nil {
+			return err
 		}
-		fmt.Println()
 
 	case "paper":
-		features, err := annotation.GetRegions(genbankFile, nuc)
+		features, err := getRegions(o.genbankFile, o.gffFasta, segments, o.nuc, o.geneticCode, o.aaNumbering == "peptide", o.naming, o.bedFiles, o.featureLabels)
 		if err != nil {
 			return err
 		}
+		regions = features
 		transitions := make([][]characterio.Transition, len(characterStates), len(characterStates))
 		for i := range transitions {
 			transitions[i] = make([]characterio.Transition, 0)
@@ -373,10 +754,11 @@ func ash(treeIn string, alignmentFile string, variantsConfig string, genbankFile
 		paper.GetPrintSynNonsynMutSpec(t)
 
 	case "epistasis":
-		features, err := annotation.GetRegions(genbankFile, nuc)
+		features, err := getRegions(o.genbankFile, o.gffFasta, segments, o.nuc, o.geneticCode, o.aaNumbering == "peptide", o.naming, o.bedFiles, o.featureLabels)
 		if err != nil {
 			return err
 		}
+		regions = features
 		// transitions := make([][]characterio.Transition, len(characterStates), len(characterStates))
 		// for i := range transitions {
 		// 	transitions[i] = make([]characterio.Transition, 0)
@@ -384,7 +766,7 @@ func ash(treeIn string, alignmentFile string, variantsConfig string, genbankFile
 		// label the changes
 		epistasis.LabelChangesAnno(t, features, characterStates, states)
 		// calculate the epistasis statistic
-		epistasis.Epistasis(t, features, threads)
+		epistasis.Epistasis(t, features, o.threads)
 	default:
 		// we can keep all the transitions (structs containing pointers to the relevant nodes and edge) in an array
 		// that matches the dimensions of the characters
@@ -403,21 +785,124 @@ func ash(treeIn string, alignmentFile string, variantsConfig string, genbankFile
 			})
 		}
 
-		if annotateNodes {
+		if o.annotateNodes {
 			parsimony.LabelNodes(t, characterStates, states, idx)
 		}
 
-		if summarize {
+		if len(o.treeOut) > 0 {
+			fout, err := os.Create(o.treeOut)
+			if err != nil {
+				return err
+			}
+			defer fout.Close()
+
+			fout.WriteString(t.NexusOptionalComments(o.annotateNodes, o.annotateTips))
+		}
+
+		if o.summarize {
 			// TO DO: swap between stdout + a hard file
 			fTrans := os.Stdout
 			var lines []string
 			for i := range transitions {
-				lines = characterio.SummarizeTransitions(threshold, transitions[i], states, idx[i], characterStates[i])
+				lines = characterio.SummarizeTransitions(o.threshold, transitions[i], states, idx[i], characterStates[i])
 				for _, l := range lines {
 					fTrans.WriteString(l + "\n")
 				}
 			}
 		}
+
+		if len(o.childrenOut) > 0 {
+			var metadata characterio.TipMetadata
+			if len(o.childrenMetadata) > 0 {
+				metadata, err = characterio.ReadTipMetadata(o.childrenMetadata)
+				if err != nil {
+					return err
+				}
+			}
+			err = characterio.WriteChildren(o.childrenOut, o.threshold, transitions, characterStates, states, idx, metadata)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(o.clustersDir) > 0 {
+			// the member sequences come from the alignment, unless there's another fasta file of them
+			if len(o.clusterSequences) == 0 && input == "alignment" {
+				o.clusterSequences = o.alignmentFile
+			}
+			clusters := characterio.GetClusters(o.threshold, transitions, characterStates, states, idx)
+			err = characterio.WriteClusters(o.clustersDir, clusters, o.clusterSequences)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(o.transitionsOut) > 0 {
+		err = characterio.WriteTransitions(o.transitionsOut, characterio.GetTransitions(t, characterStates, states, idx, regions))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(o.auspiceOut) > 0 {
+		err = characterio.WriteAuspice(o.auspiceOut, t, characterStates, states, idx, regions, preset != "none")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(o.nodeDataOut) > 0 {
+		err = characterio.WriteNodeData(o.nodeDataOut, t, characterStates, states, idx, regions)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(o.nodeStatesOut) > 0 {
+		err = characterio.WriteNodeStates(o.nodeStatesOut, o.nodeStatesFormat, t, characterStates, states, idx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(ancestors) > 0 {
+		ancestralStates := states
+		if o.ancestralMode == "resolved" {
+			ancestralStates = ancestry.Resolve(t, states, idx)
+		}
+		if len(o.ancestralFastaOut) > 0 {
+			err = writeAncestralFasta(o.ancestralFastaOut, func(f *os.File) error {
+				return ancestry.WriteFasta(f, characterStates, ancestralStates, segments, ancestors)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(o.ancestralAAFastaOut) > 0 {
+			// the CDSs (which --nuc doesn't get)
+			cdss, err := getRegions(o.genbankFile, o.gffFasta, segments, false, o.geneticCode, false, o.naming, []string{}, false)
+			if err != nil {
+				return err
+			}
+			err = writeAncestralFasta(o.ancestralAAFastaOut, func(f *os.File) error {
+				return ancestry.WriteProteinFasta(f, characterStates, ancestralStates, cdss, ancestors)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(o.matOut) > 0 {
+		references, err := referenceSequences(o.genbankFile, o.gffFasta, segments)
+		if err != nil {
+			return err
+		}
+		err = characterio.WriteMAT(o.matOut, t, states, segments, references)
+		if err != nil {
+			return err
+		}
 	}
 
 	// // write the treefile...
@@ -452,38 +937,67 @@ func ash(treeIn string, alignmentFile string, variantsConfig string, genbankFile
 
 	// // TO DO write the genotypes to file? (if so, do this in align.go)
 
-	// // if we are going to write a CSV of the children of transitions:
-	// if len(childrenOut) > 0 {
-	// 	err = characterio.WriteChildren(childrenOut, characters, atlas)
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// }
-
 	return nil
 }
 
-var treeFile string
-var alignmentFile string
-var variantsConfig string
-var genbankFile string
-var tipFile string
-var algorithmUp string   // which algorithm to use for the uppass when there are polytomies (Madison 1989)
-var algorithmDown string // which algorithm to use for resolving ties (Acctrans/Deltrans etc.)
-var annotateNodes bool
-var annotateTips bool
-var treeOut string
-var threshold int
-var childrenOut string
-var summarize bool
-var civet bool
-var nuc bool
-var p bool
-var common_anc bool
-var epi bool
-var outgroup string
-var rescale bool
-var threads int
+// options are what ash runs with, from the command line
+type options struct {
+	treeFile            string
+	alignmentFile       string
+	variantsConfig      string
+	genbankFile         string
+	tipFile             string
+	algorithmUp         string // which algorithm to use for the uppass when there are polytomies (Madison 1989)
+	algorithmDown       string // which algorithm to use for resolving ties (Acctrans/Deltrans etc.)
+	annotateNodes       bool
+	annotateTips        bool
+	treeOut             string
+	threshold           int
+	childrenOut         string
+	childrenMetadata    string
+	clustersDir         string
+	clusterSequences    string
+	summarize           bool
+	civet               bool
+	nuc                 bool
+	p                   bool
+	common_anc          bool
+	epi                 bool
+	outgroup            string
+	rescale             bool
+	threads             int
+	referenceID         string
+	insertionsOut       string
+	segmentsFile        string
+	gffFasta            string
+	geneticCode         int
+	aaNumbering         string
+	bedFiles            []string
+	featureLabels       bool
+	naming              annotation.CDSNaming
+	maskFiles           []string
+	maxMissingFraction  float64
+	missingTips         string
+	maskReport          string
+	transitionsOut      string
+	matOut              string
+	matFile             string
+	matReference        string
+	auspiceOut          string
+	nodeDataOut         string
+	nodeDataFiles       []string
+	traits              []string
+	ancestralFastaOut   string
+	ancestralAAFastaOut string
+	ancestralNodes      []string
+	ancestralMinTips    int
+	ancestralMode       string
+	nodeStatesOut       string
+	nodeStatesFormat    string
+}
+
+var opts options
+var listCDS bool
 
 var mainCmd = &cobra.Command{
 	Use:   "ash",
@@ -496,10 +1010,34 @@ Example usage:
 `,
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 
-		err = ash(treeFile, alignmentFile, variantsConfig, genbankFile, tipFile,
-			algorithmUp, algorithmDown, annotateNodes, annotateTips, threshold,
-			treeOut, childrenOut, summarize, civet, nuc, p, epi, common_anc, outgroup, rescale,
-			threads)
+		if listCDS {
+			err = listCDSs(opts.genbankFile, opts.gffFasta, opts.segmentsFile, opts.geneticCode, opts.naming)
+			return
+		}
+
+		err = ash(opts)
+
+		return
+	},
+}
+
+var clustersCmd = &cobra.Command{
+	Use:   "clusters",
+	Short: "write the clade below each transition",
+	Long: `write the clade below each transition (with more than --threshold tips) as a newick subtree and a fasta of
+its tips' sequences, named by the transition's label (e.g. nuc_23403_A-_G_2 for nuc:23403=A->G#2), and an index of them
+
+Example usage:
+
+./ash clusters --treefile tree.newick --alignment sequences.fasta --variants-config config --algo-down deltrans --threshold 10 --outdir clusters
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if len(opts.clustersDir) == 0 {
+			return errors.New("you must provide an --outdir to write the clusters to")
+		}
+
+		err = ash(opts)
 
 		return
 	},
@@ -507,27 +1045,67 @@ Example usage:
 
 func init() {
 
-	mainCmd.Flags().StringVarP(&treeFile, "treefile", "", "", "Tree file to read - must be in newick format, must be rooted")
-	mainCmd.Flags().StringVarP(&alignmentFile, "alignment", "", "", "Fasta format alignment to read")
-	mainCmd.Flags().StringVarP(&variantsConfig, "config", "", "", "Variants to type in the alignment")
-	mainCmd.Flags().StringVarP(&genbankFile, "genbank", "", "", "Genbank format annotation of a sequence in the same coordinates as the alignment")
-	mainCmd.Flags().StringVarP(&tipFile, "tipfile", "", "", "CSV format table of tip to character relationships (instead of --alignment, --variants-config and --genbank)")
-	mainCmd.Flags().StringVarP(&algorithmUp, "algo-up", "", "hard", "Algorithm to use for dealing with polytomies (choose one of soft/hard)")
-	mainCmd.Flags().StringVarP(&algorithmDown, "algo-down", "", "", "Algorithm to use for breaking ties (choose one of acctrans/deltrans/downpass)")
-	mainCmd.Flags().IntVarP(&threshold, "threshold", "", 0, "Threshold number of children, above which a transition will be included in the output (default: 0)")
-	mainCmd.Flags().StringVarP(&treeOut, "tree-out", "", "", "Tree file to write (optionally) - will be in nexus format")
-	mainCmd.Flags().BoolVarP(&annotateNodes, "annotate-nodes", "", false, "Annotate internal nodes of output tree with inferred states (default: false)")
-	mainCmd.Flags().BoolVarP(&annotateTips, "annotate-tips", "", false, "Annotate tips of output tree with known states (default: false)")
-	mainCmd.Flags().StringVarP(&childrenOut, "children-out", "", "", "CSV format file of the children of transitions to write (optionally)")
-	mainCmd.Flags().BoolVarP(&summarize, "summarize-children", "", false, "Optionally summarize the counts of children with different states under each transition to stdout")
-	mainCmd.Flags().BoolVarP(&civet, "civet", "", false, "annotate all amino acid changes + neutral nucleotide changes")
-	mainCmd.Flags().BoolVarP(&nuc, "nuc", "", false, "annotate all nucleotide changes")
-	mainCmd.Flags().BoolVarP(&p, "paper", "", false, "do papery things")
-	mainCmd.Flags().BoolVarP(&epi, "epistasis", "", false, "do epistasis things")
-	mainCmd.Flags().BoolVarP(&common_anc, "common_anc", "", false, "do common_anc things")
-	mainCmd.Flags().StringVarP(&outgroup, "outgroup", "", "", "the outgroup")
-	mainCmd.Flags().BoolVarP(&rescale, "rescale", "", false, "rescale --tree-out so branch lengths are inferred # nuc substitutions")
-	mainCmd.Flags().IntVarP(&threads, "threads", "t", 1, "number of threads to use for epistasis")
+	// the flags for reading the tree and its tips' states, and reconstructing them, which the clusters command has too
+	shared := mainCmd.PersistentFlags()
+	shared.StringVarP(&opts.treeFile, "treefile", "", "", "Tree file to read - in newick format, or an Auspice v2 JSON (.json) - must be rooted. Without an --alignment or --tipfile, a Nextstrain tree's traits are reconstructed, or for the presets that type every site, its tips' sequences come from its mutations")
+	shared.StringVarP(&opts.alignmentFile, "alignment", "", "", "Fasta format alignment to read")
+	shared.StringVarP(&opts.variantsConfig, "config", "", "", "Variants to type in the alignment")
+	shared.StringVarP(&opts.genbankFile, "genbank", "", "", "Genbank (or GFF3) format annotation of a sequence in the same coordinates as the alignment")
+	shared.StringVarP(&opts.gffFasta, "gff-fasta", "", "", "Fasta format sequence for a GFF3 --genbank annotation, if it has no ##FASTA section")
+	shared.IntVarP(&opts.geneticCode, "genetic-code", "", 1, "NCBI genetic code (transl_table) to translate CDSs with, unless they have their own /transl_table qualifier")
+	shared.StringVarP(&opts.aaNumbering, "aa-numbering", "", "cds", "Number amino acid changes in labels by CDS (cds), or by mature peptide (peptide) for residues in a mat_peptide")
+	shared.StringSliceVarP(&opts.naming.Priority, "cds-name-priority", "", annotation.DefaultCDSNaming.Priority, "Qualifiers to name CDSs by, in order of preference")
+	shared.StringVarP(&opts.naming.Collisions, "cds-collisions", "", annotation.DefaultCDSNaming.Collisions, "What to do when two CDSs get the same name: rename (add _2, _3 etc. to the later ones) or error")
+	shared.StringVarP(&opts.referenceID, "reference-id", "", "", "Name of the reference row in an --alignment that keeps insertions relative to it. All positions are then reference coordinates")
+	shared.StringVarP(&opts.tipFile, "tipfile", "", "", "CSV format table of tip to character relationships (instead of --alignment, --variants-config and --genbank)")
+	shared.StringSliceVarP(&opts.nodeDataFiles, "node-data", "", []string{}, "augur node-data JSON file(s) for a newick --treefile, e.g. from augur traits or ancestral (comma-separated, or repeat the flag)")
+	shared.StringSliceVarP(&opts.traits, "traits", "", []string{}, "traits of a Nextstrain tree (an Auspice JSON --treefile, or --node-data) to reconstruct, if there's no --tipfile (default: the categorical colorings of an Auspice JSON, or the node-data attributes with confidences, as from augur traits)")
+	shared.StringSliceVarP(&opts.maskFiles, "mask-sites", "", []string{}, "VCF, BED or list file(s) of sites to set to missing data in every tip before the reconstruction")
+	shared.Float64VarP(&opts.maxMissingFraction, "max-missing-fraction", "", 1, "Mask or prune (see --missing-tips) tips that are missing more than this fraction of the (unmasked) sites")
+	shared.StringVarP(&opts.missingTips, "missing-tips", "", "mask", "What to do with tips over --max-missing-fraction: mask (set all their sites to missing) or prune (remove them from the tree)")
+	shared.StringVarP(&opts.maskReport, "mask-report", "", "", "TSV file of the sites and tips that were masked, and why, to write (default: stderr)")
+	shared.StringVarP(&opts.algorithmUp, "algo-up", "", "hard", "Algorithm to use for dealing with polytomies (choose one of soft/hard)")
+	shared.StringVarP(&opts.algorithmDown, "algo-down", "", "", "Algorithm to use for breaking ties (choose one of acctrans/deltrans/downpass)")
+	shared.IntVarP(&opts.threshold, "threshold", "", 0, "Threshold number of children, above which a transition will be included in the output (default: 0)")
+	shared.SortFlags = false
+
+	clustersCmd.Flags().StringVarP(&opts.clustersDir, "outdir", "", "", "Directory to write the clusters and their index to")
+	clustersCmd.Flags().StringVarP(&opts.clusterSequences, "sequences", "", "", "Fasta file of the tips' sequences to write for each cluster (default: the --alignment, if there is one)")
+
+	mainCmd.AddCommand(clustersCmd)
+
+	mainCmd.Flags().BoolVarP(&opts.featureLabels, "feature-labels", "", false, "Label nucleotide changes with the names of the non-coding features they are in, e.g. 5'UTR:C241T (default: false)")
+	mainCmd.Flags().StringSliceVarP(&opts.bedFiles, "bed", "", []string{}, "BED file(s) of genomic features to label nucleotide changes with, as well as the non-coding features in the annotation (needs --feature-labels)")
+	mainCmd.Flags().BoolVarP(&listCDS, "list-cds", "", false, "List the CDSs in the annotation, with the names they will be given, then exit")
+	mainCmd.Flags().StringVarP(&opts.matFile, "mat", "", "", "UShER protobuf (.pb) mutation-annotated tree to read as the tree and its tips' states (instead of --treefile and --alignment)")
+	mainCmd.Flags().StringVarP(&opts.matReference, "mat-reference", "", "", "Fasta format reference sequence of the --mat, or root sequence of a Nextstrain tree's mutations (default: the tree's root sequence, or the --genbank sequence)")
+	mainCmd.Flags().StringVarP(&opts.treeOut, "tree-out", "", "", "Tree file to write (optionally) - will be in nexus format")
+	mainCmd.Flags().BoolVarP(&opts.annotateNodes, "annotate-nodes", "", false, "Annotate internal nodes of output tree with inferred states (default: false)")
+	mainCmd.Flags().BoolVarP(&opts.annotateTips, "annotate-tips", "", false, "Annotate tips of output tree with known states (default: false)")
+	mainCmd.Flags().StringVarP(&opts.transitionsOut, "transitions-out", "", "", "JSON file of every inferred change to write (optionally) - JSON Lines if it ends in .jsonl")
+	mainCmd.Flags().StringVarP(&opts.matOut, "mat-out", "", "", "UShER protobuf (.pb) mutation-annotated tree to write (optionally), with the --genbank sequence as its reference")
+	mainCmd.Flags().StringVarP(&opts.auspiceOut, "auspice-out", "", "", "Auspice v2 JSON file to write (optionally) - with the mutations on each branch for the presets that type every site, otherwise with the reconstructed characters as traits")
+	mainCmd.Flags().StringVarP(&opts.nodeDataOut, "node-data-out", "", "", "augur node-data JSON file to write (optionally) - the nucleotide and amino acid mutations on each branch and the root sequence, for augur export")
+	mainCmd.Flags().StringVarP(&opts.nodeStatesOut, "node-states-out", "", "", "TSV file of the reconstructed states of every character at every node to write (optionally)")
+	mainCmd.Flags().StringVarP(&opts.nodeStatesFormat, "node-states-format", "", "wide", "Format of --node-states-out: one row per node with a column per character (wide), or one row per node and character (long)")
+	mainCmd.Flags().StringVarP(&opts.ancestralFastaOut, "ancestral-fasta-out", "", "", "Fasta file of the reconstructed sequences of the internal nodes to write (optionally), named as in --tree-out")
+	mainCmd.Flags().StringVarP(&opts.ancestralAAFastaOut, "ancestral-aa-fasta-out", "", "", "Fasta file of the translated CDSs of the internal nodes to write (optionally), named node|CDS")
+	mainCmd.Flags().StringSliceVarP(&opts.ancestralNodes, "ancestral-nodes", "", []string{}, "Internal nodes to write the ancestral sequences of, by name (e.g. NODE_0000001) (default: all of them)")
+	mainCmd.Flags().IntVarP(&opts.ancestralMinTips, "ancestral-min-tips", "", 0, "Only write the ancestral sequences of nodes with at least this many tips below them")
+	mainCmd.Flags().StringVarP(&opts.ancestralMode, "ancestral-mode", "", "iupac", "Ancestral sequences with IUPAC codes where the reconstruction is ambiguous (iupac), or with one state per site (resolved), preferring the parent's")
+	mainCmd.Flags().StringVarP(&opts.childrenOut, "children-out", "", "", "CSV format file of the children of transitions (with more than --threshold children) and their states to write (optionally)")
+	mainCmd.Flags().StringVarP(&opts.childrenMetadata, "children-metadata", "", "", "CSV (or .tsv) file of tip metadata, with the tip names in the first column, to join to --children-out")
+	mainCmd.Flags().BoolVarP(&opts.summarize, "summarize-children", "", false, "Optionally summarize the counts of children with different states under each transition to stdout")
+	mainCmd.Flags().BoolVarP(&opts.civet, "civet", "", false, "annotate all amino acid changes + neutral nucleotide changes")
+	mainCmd.Flags().BoolVarP(&opts.nuc, "nuc", "", false, "annotate all nucleotide changes")
+	mainCmd.Flags().BoolVarP(&opts.p, "paper", "", false, "do papery things")
+	mainCmd.Flags().BoolVarP(&opts.epi, "epistasis", "", false, "do epistasis things")
+	mainCmd.Flags().BoolVarP(&opts.common_anc, "common_anc", "", false, "do common_anc things")
+	mainCmd.Flags().StringVarP(&opts.outgroup, "outgroup", "", "", "the outgroup")
+	mainCmd.Flags().BoolVarP(&opts.rescale, "rescale", "", false, "rescale --tree-out so branch lengths are inferred # nuc substitutions")
+	mainCmd.Flags().IntVarP(&opts.threads, "threads", "t", 1, "number of threads to use for epistasis")
+	mainCmd.Flags().StringVarP(&opts.segmentsFile, "segments", "", "", "CSV file of name,alignment,genbank[,gff-fasta] for each segment of a multi-segment genome (instead of --alignment and --genbank, for the presets that type every site)")
+	mainCmd.Flags().StringVarP(&opts.insertionsOut, "insertions-out", "", "", "TSV file of the insertion columns relative to --reference-id to write (optionally, for the presets that type every site, with an --alignment)")
 
 	mainCmd.Flags().Lookup("annotate-nodes").NoOptDefVal = "true"
 	mainCmd.Flags().Lookup("annotate-tips").NoOptDefVal = "true"
@@ -538,6 +1116,7 @@ func init() {
 	mainCmd.Flags().Lookup("epistasis").NoOptDefVal = "true"
 	mainCmd.Flags().Lookup("common_anc").NoOptDefVal = "true"
 	mainCmd.Flags().Lookup("rescale").NoOptDefVal = "true"
+	mainCmd.Flags().Lookup("list-cds").NoOptDefVal = "true"
 
 	mainCmd.Flags().SortFlags = false
 }
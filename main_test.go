@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/ash/pkg/characterio"
+)
+
+func Test_checkArgs(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(configFile, []byte("nuc:1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		alignmentFile  string
+		variantsConfig string
+		tipFile        string
+		segmentsFile   string
+		insertionsOut  string
+		nuc            bool
+		desiredInput   string // or empty for an error
+	}{
+		{"aln.fasta", "", "", "", "", true, "alignment"},
+		{"aln.fasta", configFile, "", "", "", false, "alignment"},
+		{"aln.fasta", "", "", "", "insertions.tsv", true, "alignment"},
+		{"", "", "", "segments.csv", "", true, "segments"},
+		{"", "", "tips.csv", "", "", false, "csv"},
+		// --segments is only for the presets that type every site, and its insertions can't be written
+		{"", "", "", "segments.csv", "", false, ""},
+		{"", configFile, "", "segments.csv", "", true, ""},
+		{"", "", "", "segments.csv", "insertions.tsv", true, ""},
+		{"aln.fasta", "", "", "segments.csv", "", true, ""},
+	}
+
+	for _, test := range tests {
+		_, _, input, _, err := checkArgs("tree.nwk", test.alignmentFile, test.variantsConfig, "", test.tipFile, "hard", "acctrans", "",
+			false, test.nuc, false, false, false, test.segmentsFile, test.insertionsOut, "", []string{})
+		if len(test.desiredInput) == 0 {
+			if err == nil {
+				t.Errorf("error in Test_checkArgs")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		if input != test.desiredInput {
+			t.Errorf("error in Test_checkArgs")
+		}
+	}
+}
+
+func Test_getRegions(t *testing.T) {
+	// the annotation has a 5'UTR, so changes in it are only labelled with its name with --feature-labels
+	tests := []struct {
+		featureLabels bool
+		desiredResult string
+	}{
+		{true, "UTR:"},
+		{false, ""},
+	}
+
+	for _, test := range tests {
+		regions, err := getRegions("pkg/annotation/testdata/overlap.gb", "", []characterio.Segment{}, false, 1, false, annotation.DefaultCDSNaming, []string{}, test.featureLabels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if regions[0].FeaturePrefix(5) != test.desiredResult {
+			t.Errorf("error in Test_getRegions")
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package ancestry
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/ash/pkg/bitsets"
+	"github.com/benjamincjackson/ash/pkg/characterio"
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+// Node is a node to write the sequence of, and the name to write it with
+type Node struct {
+	ID   int
+	Name string
+}
+
+// SelectNodes gets the internal nodes to write the sequences of: the ones named in names (by their names in the tree, or
+// as in characterio.NodeNames), or if names is empty, all of them. Nodes with fewer than minTips tips below them are left out
+func SelectNodes(t *tree.Tree, names []string, minTips int) ([]Node, error) {
+
+	nodeNames := characterio.NodeNames(t)
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	tipCounts := make(map[int]int)
+	characterio.CountTips(t.Root(), nil, tipCounts)
+
+	nodes := make([]Node, 0)
+	found := make(map[string]bool)
+	var walk func(cur, prev *tree.Node)
+	walk = func(cur, prev *tree.Node) {
+		if cur.Tip() && prev != nil {
+			return
+		}
+		name := nodeNames[cur.Id()]
+		if (len(names) == 0 || wanted[name]) && tipCounts[cur.Id()] >= minTips {
+			nodes = append(nodes, Node{ID: cur.Id(), Name: name})
+		}
+		found[name] = true
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				walk(n, cur)
+			}
+		}
+	}
+	walk(t.Root(), nil)
+
+	for _, name := range names {
+		if !found[name] {
+			return []Node{}, errors.New("couldn't find an internal node called " + name + " in the tree")
+		}
+	}
+
+	return nodes, nil
+}
+
+// Resolve returns a copy of the states with one state per character at every node that has any: the parent's state if
+// the node can have it, otherwise the first of its states. So a resolved sequence doesn't have changes that the
+// reconstruction doesn't need
+func Resolve(t *tree.Tree, states [][]byte, idx []characterio.StartStop) [][]byte {
+
+	resolved := make([][]byte, len(states))
+	for i := range states {
+		resolved[i] = make([]byte, len(states[i]))
+	}
+
+	var walk func(cur, prev *tree.Node)
+	walk = func(cur, prev *tree.Node) {
+		id := cur.Id()
+		for i := range idx {
+			start, stop := idx[i].Start, idx[i].Stop
+			setbits := bitsets.GetSetBits(states[id][start:stop])
+			if len(setbits) == 0 {
+				continue
+			}
+			bit := setbits[0]
+			if prev != nil {
+				parentbits := bitsets.GetSetBits(resolved[prev.Id()][start:stop])
+				if len(parentbits) == 1 && bitsets.IsSubset(resolved[prev.Id()][start:stop], states[id][start:stop]) {
+					bit = parentbits[0]
+				}
+			}
+			bitsets.SetBit(resolved[id][start:stop], bit)
+		}
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				walk(n, cur)
+			}
+		}
+	}
+	walk(t.Root(), nil)
+
+	return resolved
+}
+
+// Sequence is the nucleotide sequence of one node, with IUPAC codes for ambiguous sites, and N for missing data. The
+// characters must be the sites of the (concatenated) alignment
+func Sequence(characters []characterio.CharacterStruct, states [][]byte, id int) string {
+	IUPACMap := annotation.GetIUPACMap()
+	var sb strings.Builder
+	for i := range characters {
+		setBits := bitsets.GetSetBits(states[id][i : i+1])
+		nucstates := make([]string, 0)
+		for _, b := range setBits {
+			nucstates = append(nucstates, characters[i].StateKey[b-1])
+		}
+		// sort them, for translating to the correct ambiguity code
+		sort.Strings(nucstates)
+		if nuc, ok := IUPACMap[strings.Join(nucstates, "")]; ok {
+			sb.WriteString(nuc)
+		} else {
+			sb.WriteString("N")
+		}
+	}
+	return sb.String()
+}
+
+// Translate translates a CDS from a node's (concatenated) sequence. Codons that can't be translated unambiguously are X
+func Translate(region annotation.Region, sequence string) string {
+	codonDict := annotation.CodonDict(region.TranslTable)
+	var sb strings.Builder
+	for _, sites := range region.Codons {
+		codon := string([]byte{sequence[sites[0]-1], sequence[sites[1]-1], sequence[sites[2]-1]})
+		// CDSs on the minus strand are read from the complement of their sites
+		if region.Complement {
+			codon = annotation.Complement(codon)
+		}
+		if aa, ok := codonDict[codon]; ok {
+			sb.WriteString(aa)
+		} else {
+			sb.WriteString("X")
+		}
+	}
+	return sb.String()
+}
+
+// WriteFasta writes the nucleotide sequence of each node. For multi-segment genomes, each node has one record per segment,
+// named node|segment
+func WriteFasta(w io.Writer, characters []characterio.CharacterStruct, states [][]byte, segments []characterio.Segment, nodes []Node) error {
+
+	if len(segments) == 0 {
+		segments = []characterio.Segment{{Name: "", Offset: 0, Length: len(characters)}}
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, node := range nodes {
+		sequence := Sequence(characters, states, node.ID)
+		for _, segment := range segments {
+			name := node.Name
+			if len(segment.Name) > 0 {
+				name = name + "|" + segment.Name
+			}
+			_, err := bw.WriteString(">" + name + "\n" + sequence[segment.Offset:segment.Offset+segment.Length] + "\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WriteProteinFasta writes the translation of every CDS in the regions for each node, named node|CDS
+func WriteProteinFasta(w io.Writer, characters []characterio.CharacterStruct, states [][]byte, regions []annotation.Region, nodes []Node) error {
+
+	bw := bufio.NewWriter(w)
+	for _, node := range nodes {
+		sequence := Sequence(characters, states, node.ID)
+		for _, region := range regions {
+			if region.Whichtype != "CDS" {
+				continue
+			}
+			_, err := bw.WriteString(">" + node.Name + "|" + region.LabelPrefix() + region.Name + "\n" + Translate(region, sequence) + "\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,165 @@
+package ancestry
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/ash/pkg/characterio"
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+// every character is a nucleotide site
+func nucCharacters(n int) ([]characterio.CharacterStruct, []characterio.StartStop) {
+	characters := make([]characterio.CharacterStruct, n)
+	idx := make([]characterio.StartStop, n)
+	for i := range characters {
+		characters[i].StateKey = []string{"A", "C", "G", "T"}
+		idx[i] = characterio.StartStop{Start: i, Stop: i + 1}
+	}
+	return characters, idx
+}
+
+func Test_SelectNodes(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a,b),(c,d,e)x);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		names         []string
+		minTips       int
+		desiredResult []Node
+	}{
+		{[]string{}, 0, []Node{{0, "NODE_0000000"}, {1, "NODE_0000001"}, {4, "x"}}},
+		{[]string{"x", "NODE_0000001"}, 0, []Node{{1, "NODE_0000001"}, {4, "x"}}},
+		{[]string{}, 3, []Node{{0, "NODE_0000000"}, {4, "x"}}},
+		// a tip isn't an internal node
+		{[]string{"a"}, 0, nil},
+		{[]string{"y"}, 0, nil},
+	}
+
+	for _, test := range tests {
+		nodes, err := SelectNodes(tr, test.names, test.minTips)
+		if test.desiredResult == nil {
+			if err == nil {
+				t.Errorf("error in Test_SelectNodes")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(nodes, test.desiredResult) {
+			t.Errorf("error in Test_SelectNodes")
+		}
+	}
+}
+
+func Test_Resolve(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a,b),c);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, idx := nucCharacters(1)
+
+	// the root is A|G, so it is resolved to A. The internal node can't be A, so it is resolved to G (its first state),
+	// which a then has too. b is missing data, and c can be A, like the root
+	states := [][]byte{{160}, {48}, {160}, {0}, {192}}
+	desiredResult := [][]byte{{128}, {32}, {32}, {0}, {128}}
+
+	if !reflect.DeepEqual(Resolve(tr, states, idx), desiredResult) {
+		t.Errorf("error in Test_Resolve")
+	}
+	// the states themselves aren't changed
+	if states[0][0] != 160 {
+		t.Errorf("error in Test_Resolve")
+	}
+}
+
+func Test_Sequence(t *testing.T) {
+	characters, _ := nucCharacters(4)
+	tests := []struct {
+		states        []byte
+		desiredResult string
+	}{
+		{[]byte{128, 64, 32, 16}, "ACGT"},
+		// ambiguous sites are IUPAC codes, and missing data is N
+		{[]byte{128, 160, 0, 240}, "ARNN"},
+	}
+
+	for _, test := range tests {
+		if Sequence(characters, [][]byte{test.states}, 0) != test.desiredResult {
+			t.Errorf("error in Test_Sequence")
+		}
+	}
+}
+
+func Test_Translate(t *testing.T) {
+	tests := []struct {
+		region        annotation.Region
+		sequence      string
+		desiredResult string
+	}{
+		{annotation.Region{Codons: [][3]int{{1, 2, 3}, {4, 5, 6}}, TranslTable: 1}, "ATGCAT", "MH"},
+		{annotation.Region{Codons: [][3]int{{6, 5, 4}}, Complement: true, TranslTable: 1}, "ATGCAT", "M"},
+		// a codon that spans an intron, on the minus strand
+		{annotation.Region{Codons: [][3]int{{6, 5, 1}}, Complement: true, TranslTable: 1}, "ATGCAT", "I"},
+		// an ambiguous codon that is still one amino acid, and one that isn't
+		{annotation.Region{Codons: [][3]int{{1, 2, 3}, {4, 5, 6}}, TranslTable: 1}, "GARNNN", "EX"},
+		// TGA is W in the vertebrate mitochondrial code
+		{annotation.Region{Codons: [][3]int{{1, 2, 3}}, TranslTable: 2}, "TGA", "W"},
+	}
+
+	for _, test := range tests {
+		if Translate(test.region, test.sequence) != test.desiredResult {
+			t.Errorf("error in Test_Translate")
+		}
+	}
+}
+
+func Test_WriteFasta(t *testing.T) {
+	characters, _ := nucCharacters(4)
+	states := [][]byte{{128, 160, 0, 16}, {128, 64, 32, 16}}
+	nodes := []Node{{0, "NODE_0000000"}, {1, "x"}}
+
+	tests := []struct {
+		segments      []characterio.Segment
+		desiredResult string
+	}{
+		{[]characterio.Segment{}, ">NODE_0000000\nARNT\n>x\nACGT\n"},
+		{[]characterio.Segment{{Name: "S1", Offset: 0, Length: 3}, {Name: "S2", Offset: 3, Length: 1}},
+			">NODE_0000000|S1\nARN\n>NODE_0000000|S2\nT\n>x|S1\nACG\n>x|S2\nT\n"},
+	}
+
+	for _, test := range tests {
+		var sb strings.Builder
+		err := WriteFasta(&sb, characters, states, test.segments, nodes)
+		if err != nil {
+			t.Error(err)
+		}
+		if sb.String() != test.desiredResult {
+			t.Errorf("error in Test_WriteFasta")
+		}
+	}
+}
+
+func Test_WriteProteinFasta(t *testing.T) {
+	characters, _ := nucCharacters(6)
+	states := [][]byte{{128, 16, 32, 32, 128, 128}}
+	regions := []annotation.Region{
+		{Whichtype: "CDS", Name: "G1", Codons: [][3]int{{1, 2, 3}, {4, 5, 6}}, TranslTable: 1},
+		{Whichtype: "int", Name: "int1"},
+		{Whichtype: "CDS", Name: "HA1", Segment: "HA", Codons: [][3]int{{3, 4, 5}}, TranslTable: 1},
+	}
+
+	var sb strings.Builder
+	err := WriteProteinFasta(&sb, characters, states, regions, []Node{{0, "x"}})
+	if err != nil {
+		t.Error(err)
+	}
+	if sb.String() != ">x|G1\nME\n>x|HA:HA1\nG\n" {
+		t.Errorf("error in Test_WriteProteinFasta")
+	}
+}
@@ -2,6 +2,7 @@ package annotation
 
 import (
 	"errors"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -11,11 +12,52 @@ import (
 // Region is a struct containing a part of the genome which might
 // be a CDS or intergenic, for example
 type Region struct {
-	Whichtype   string // int(ergenic) or CDS
-	Name        string // name of CDS, if it is one
-	Start       int    // 1-based first position of region, inclusive
-	Stop        int    // 1-based last position of region, inclusive
-	Codonstarts []int  // a slice of the 1-based start positions of all its codons, if this region is a CDS
+	Whichtype   string    // int(ergenic) or CDS
+	Name        string    // name of CDS, if it is one
+	Start       int       // 1-based first position of region, inclusive
+	Stop        int       // 1-based last position of region, inclusive
+	Codons      [][3]int  // the 1-based sites of each of its codons in reading order, if this region is a CDS. A codon can span an intron (or a ribosomal slippage)
+	Peptides    []Peptide // the mature peptides of this region, if it is a polyprotein CDS and we are using their numbering
+	Features    []Feature // the non-coding features (UTRs, stem-loops, BED regions etc.) that overlap this region
+	TranslTable int       // the NCBI genetic code of this region, if it is a CDS
+	Complement  bool      // true if this region is a CDS on the minus strand. Its codons' sites are then in decreasing order, and each one is read as its complement
+	Segment     string    // name of the segment this region is on, for multi-segment genomes
+	Offset      int       // how many sites come before this region's segment, for multi-segment genomes
+}
+
+// OffsetRegions shifts the regions from one segment of a multi-segment genome into the coordinates
+// of the concatenated genome, and labels them with the segment's name
+func OffsetRegions(regions []Region, segment string, offset int) []Region {
+	shifted := make([]Region, len(regions))
+	for i, r := range regions {
+		shifted[i] = r
+		shifted[i].Segment = segment
+		shifted[i].Offset = offset
+		shifted[i].Start = r.Start + offset
+		shifted[i].Stop = r.Stop + offset
+		shifted[i].Codons = make([][3]int, len(r.Codons))
+		for j := range r.Codons {
+			for k := range r.Codons[j] {
+				shifted[i].Codons[j][k] = r.Codons[j][k] + offset
+			}
+		}
+		shifted[i].Features = make([]Feature, len(r.Features))
+		for j := range r.Features {
+			shifted[i].Features[j] = r.Features[j]
+			shifted[i].Features[j].Start = r.Features[j].Start + offset
+			shifted[i].Features[j].Stop = r.Features[j].Stop + offset
+		}
+	}
+	return shifted
+}
+
+// LabelPrefix is what the labels for changes in this region start with: the segment name
+// for multi-segment genomes, otherwise nothing
+func (r Region) LabelPrefix() string {
+	if len(r.Segment) > 0 {
+		return r.Segment + ":"
+	}
+	return ""
 }
 
 // from a string representation of all the nucleotides a state is (sorted in increasing order),
@@ -41,17 +83,44 @@ func GetIUPACMap() map[string]string {
 	return m
 }
 
-// get the positions of the CDS and the not-CDS from the genbank.
+// get the positions of the CDS and the not-CDS from the annotation (genbank, or GFF3 with its fasta).
+// CDSs without a /transl_table qualifier are translated with geneticCode. If matPeptides is true, the
+// mat_peptide features are attached to the CDSs they are in, so that residues are numbered by peptide.
+// CDSs are named according to naming.
 // return a slice of Region structs
-func GetRegions(genbankFileIn string, nuc bool) ([]Region, error) {
-	gb, err := genbank.ReadGenBank(genbankFileIn)
+func GetRegions(annotationFile string, fastaFile string, nuc bool, geneticCode int, matPeptides bool, naming CDSNaming) ([]Region, error) {
+	gb, err := ReadAnnotation(annotationFile, fastaFile)
+	if err != nil {
+		return make([]Region, 0), err
+	}
+
+	regions, err := regionsFromAnnotation(gb, nuc, geneticCode, matPeptides, naming)
+	if err != nil {
+		return make([]Region, 0), errors.New(annotationFile + ": " + err.Error())
+	}
+
+	return regions, nil
+}
+
+// partition a genome into regions from its annotation. Every site is in exactly one intergenic region,
+// or in one or more (possibly overlapping) CDSs
+func regionsFromAnnotation(gb genbank.Genbank, nuc bool, geneticCode int, matPeptides bool, naming CDSNaming) ([]Region, error) {
+
+	genomeLength := len(gb.ORIGIN)
+	if genomeLength == 0 {
+		return make([]Region, 0), errors.New("the annotation has no sequence")
+	}
+
+	features, err := getNonCodingFeatures(gb)
 	if err != nil {
 		return make([]Region, 0), err
 	}
 
 	if nuc {
-		REGION := Region{Whichtype: "int", Start: 1, Stop: len(gb.ORIGIN)}
-		return []Region{REGION}, nil
+		REGION := Region{Whichtype: "int", Start: 1, Stop: genomeLength}
+		regions := []Region{REGION}
+		AttachFeatures(regions, features)
+		return regions, nil
 	}
 
 	CDSFEATS := make([]genbank.GenbankFeature, 0)
@@ -61,99 +130,236 @@ func GetRegions(genbankFileIn string, nuc bool) ([]Region, error) {
 		}
 	}
 
+	cdsnames, err := NameCDSs(CDSFEATS, naming)
+	if err != nil {
+		return make([]Region, 0), err
+	}
+
 	cdsregions := make([]Region, 0)
 
 	// we get all the CDSes
-	for _, feat := range CDSFEATS {
-		REGION := Region{Whichtype: "CDS", Name: feat.Info["gene"], Codonstarts: make([]int, 0)}
+	for i, feat := range CDSFEATS {
+		REGION := Region{Whichtype: "CDS", Name: cdsnames[i]}
+
+		REGION.TranslTable, err = TranslTable(feat.Info, geneticCode)
+		if err != nil {
+			return make([]Region, 0), err
+		}
 
 		// these are genbank positions, so they are 1-based, inclusive
-		positions, err := parsePositions(feat.Pos)
+		positions, complement, err := ParseLocation(feat.Pos)
 		if err != nil {
 			return make([]Region, 0), err
 		}
 		REGION.Start = positions[0]
 		REGION.Stop = positions[len(positions)-1]
+		REGION.Complement = complement
 
-		// how many codons we have already defined if this CDS is two ranges Join()ed together:
-		previouscodons := 0
 		for i := 0; i < len(positions); i = i + 2 {
-			start := positions[i]
-			stop := positions[i+1]
-
-			// start-1 to get the start position as 0-based
-			if (stop-(start-1))%3 != 0 {
-				return make([]Region, 0), errors.New("CDS position range is not a multiple of 3")
-			}
-			length := (stop - (start - 1))
-
-			for j := 0; j < length; j = j + 3 {
-				// we add another integer codon start to the slice
-				REGION.Codonstarts = append(REGION.Codonstarts, start+j)
+			if positions[i] < 1 || positions[i+1] < positions[i] || positions[i+1] > genomeLength {
+				return make([]Region, 0), errors.New("CDS " + REGION.Name + " (" + feat.Pos + ") is out of range of the genome, which is " + strconv.Itoa(genomeLength) + " long")
 			}
+		}
 
-			previouscodons = previouscodons + (length / 3)
+		REGION.Codons, err = CodonSites(positions, complement)
+		if err != nil {
+			return make([]Region, 0), errors.New("CDS length is not a multiple of 3: " + REGION.Name + " (" + feat.Pos + ")")
 		}
 		cdsregions = append(cdsregions, REGION)
 	}
 
-	// then we add the intergenic regions (between the CDSes)
-	regions := make([]Region, 0)
-	newstart := 1
-	for i, cdsregion := range cdsregions {
-		start := newstart
-		stop := cdsregion.Start - 1
+	if matPeptides {
+		err = attachPeptides(cdsregions, gb.FEATURES)
+		if err != nil {
+			return make([]Region, 0), err
+		}
+	}
 
-		// hopefully this deals with any cases where there isn't an intergenic region:
-		if !((stop - start) > 0) {
+	// then we add the intergenic regions, which are the runs of sites that aren't in any CDS.
+	// CDSs can overlap, so a site can be in more than one CDS
+	incds := make([]bool, genomeLength+1)
+	for _, cdsregion := range cdsregions {
+		for _, codon := range cdsregion.Codons {
+			for _, pos := range codon {
+				incds[pos] = true
+			}
+		}
+	}
+
+	regions := make([]Region, 0)
+	for pos := 1; pos < len(incds); pos++ {
+		if incds[pos] {
 			continue
 		}
-		REGION := Region{Whichtype: "int", Start: start, Stop: stop}
-		regions = append(regions, REGION)
-		regions = append(regions, cdsregion)
-		newstart = cdsregion.Stop + 1
-		if i == len(cdsregions) {
-			start := newstart
-			stop := len(gb.ORIGIN)
-			if !((stop - start) > 0) {
-				continue
-			}
-			REGION := Region{Whichtype: "int", Start: start, Stop: stop}
-			regions = append(regions, REGION)
+		if len(regions) > 0 && regions[len(regions)-1].Stop == pos-1 {
+			regions[len(regions)-1].Stop = pos
+			continue
 		}
+		regions = append(regions, Region{Whichtype: "int", Start: pos, Stop: pos})
+	}
+
+	regions = append(regions, cdsregions...)
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].Start < regions[j].Start })
+
+	AttachFeatures(regions, features)
+
+	err = validateRegions(regions, genomeLength)
+	if err != nil {
+		return make([]Region, 0), err
 	}
 
 	return regions, nil
 }
 
-func parsePositions(position string) ([]int, error) {
-	var A []int
-	if position[0:4] == "join" {
-		A = make([]int, 0)
-		position = strings.TrimLeft(position, "join(")
-		position = strings.TrimRight(position, ")")
-		ranges := strings.Split(position, ",")
-		for _, x := range ranges {
-			y := strings.Split(x, "..")
-			for _, z := range y {
-				temp, err := strconv.Atoi(z)
-				if err != nil {
-					return []int{}, err
+// check that every site in the genome is in exactly one intergenic region or in at least one CDS (but not both),
+// and that the regions are in order
+func validateRegions(regions []Region, genomeLength int) error {
+
+	inInt := make([]int, genomeLength+1)
+	inCDS := make([]int, genomeLength+1)
+
+	for i, r := range regions {
+		if r.Start < 1 || r.Stop > genomeLength || r.Stop < r.Start {
+			return errors.New("region " + strconv.Itoa(r.Start) + "-" + strconv.Itoa(r.Stop) + " is out of range of the genome")
+		}
+		if i > 0 && r.Start < regions[i-1].Start {
+			return errors.New("regions are not in order")
+		}
+		switch r.Whichtype {
+		case "int":
+			for pos := r.Start; pos <= r.Stop; pos++ {
+				inInt[pos]++
+			}
+		case "CDS":
+			for _, codon := range r.Codons {
+				for _, pos := range codon {
+					if pos < 1 || pos > genomeLength {
+						return errors.New("CDS " + r.Name + " has a codon out of range of the genome")
+					}
+					inCDS[pos]++
 				}
-				A = append(A, temp)
 			}
 		}
-	} else {
-		A = make([]int, 0)
-		y := strings.Split(position, "..")
+	}
+
+	for pos := 1; pos <= genomeLength; pos++ {
+		switch {
+		case inInt[pos] == 0 && inCDS[pos] == 0:
+			return errors.New("site " + strconv.Itoa(pos) + " isn't in any region")
+		case inInt[pos] > 1, inInt[pos] > 0 && inCDS[pos] > 0:
+			return errors.New("site " + strconv.Itoa(pos) + " is in an intergenic region and another region")
+		}
+	}
+
+	return nil
+}
+
+// ParseLocation parses a genbank location string (e.g. "1..10", "join(1..10,20..30)", "complement(1..10)",
+// "complement(join(1..10,20..30))" or "join(complement(20..30),complement(1..10))") into a flat slice of 1-based,
+// inclusive start and stop positions in increasing order, and whether the feature is on the minus strand
+func ParseLocation(location string) ([]int, bool, error) {
+
+	complement := strings.Contains(location, "complement(")
+
+	// we only need the ranges, so we can strip the operators
+	for _, operator := range []string{"complement(", "join(", "order(", ")", "<", ">"} {
+		location = strings.ReplaceAll(location, operator, "")
+	}
+
+	A := make([]int, 0)
+	for _, x := range strings.Split(location, ",") {
+		y := strings.Split(strings.TrimSpace(x), "..")
+		if len(y) == 1 {
+			// a single position
+			y = append(y, y[0])
+		}
+		if len(y) != 2 {
+			return []int{}, false, errors.New("couldn't parse genbank location: " + location)
+		}
 		for _, z := range y {
 			temp, err := strconv.Atoi(z)
 			if err != nil {
-				return []int{}, err
+				return []int{}, false, err
 			}
 			A = append(A, temp)
 		}
 	}
 
-	return A, nil
+	// the ranges of minus-strand features can be listed in reading order, so we sort them
+	ranges := make([][2]int, 0)
+	for i := 0; i < len(A); i += 2 {
+		ranges = append(ranges, [2]int{A[i], A[i+1]})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	for i := range ranges {
+		A[i*2] = ranges[i][0]
+		A[i*2+1] = ranges[i][1]
+	}
+
+	return A, complement, nil
+}
+
+// the complement of each nucleotide (including ambiguity codes)
+var complementMap = map[byte]byte{
+	'A': 'T', 'C': 'G', 'G': 'C', 'T': 'A',
+	'M': 'K', 'R': 'Y', 'W': 'W', 'S': 'S', 'Y': 'R', 'K': 'M',
+	'V': 'B', 'H': 'D', 'D': 'H', 'B': 'V', 'N': 'N', '-': '-',
+}
+
+// ReverseComplement returns the reverse complement of a nucleotide sequence in upper case,
+// e.g. to translate a codon on the minus strand
+func ReverseComplement(seq string) string {
+	c := Complement(seq)
+	rc := make([]byte, len(c))
+	for i := 0; i < len(c); i++ {
+		rc[len(c)-1-i] = c[i]
+	}
+	return string(rc)
+}
+
+// Complement returns the complement of a nucleotide sequence in upper case, e.g. to translate a codon
+// on the minus strand whose sites are already in reading order
+func Complement(seq string) string {
+	seq = strings.ToUpper(seq)
+	c := make([]byte, len(seq))
+	for i := 0; i < len(seq); i++ {
+		b, ok := complementMap[seq[i]]
+		if !ok {
+			b = 'N'
+		}
+		c[i] = b
+	}
+	return string(c)
+}
+
+// LocationSites gets all the sites of a location (as parsed by ParseLocation) in reading order, which for the minus
+// strand is from the end of the last range backwards
+func LocationSites(positions []int, complement bool) []int {
+	sites := make([]int, 0)
+	for i := 0; i+1 < len(positions); i = i + 2 {
+		for pos := positions[i]; pos <= positions[i+1]; pos++ {
+			sites = append(sites, pos)
+		}
+	}
+	if complement {
+		for i, j := 0, len(sites)-1; i < j; i, j = i+1, j-1 {
+			sites[i], sites[j] = sites[j], sites[i]
+		}
+	}
+	return sites
+}
+
+// CodonSites splits the sites of a location (as parsed by ParseLocation) into codons, in reading order. Only the
+// whole (spliced) location has to be a whole number of codons, so a codon can span two ranges
+func CodonSites(positions []int, complement bool) ([][3]int, error) {
+	sites := LocationSites(positions, complement)
+	if len(sites) == 0 || len(sites)%3 != 0 {
+		return [][3]int{}, errors.New("location length is not a multiple of 3")
+	}
+
+	codons := make([][3]int, 0, len(sites)/3)
+	for i := 0; i < len(sites); i = i + 3 {
+		codons = append(codons, [3]int{sites[i], sites[i+1], sites[i+2]})
+	}
+	return codons, nil
 }
@@ -0,0 +1,301 @@
+package annotation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_OffsetRegions(t *testing.T) {
+	regions := []Region{
+		{Whichtype: "int", Start: 1, Stop: 3, Features: []Feature{{Type: "5'UTR", Name: "5'UTR", Start: 1, Stop: 3}}},
+		{Whichtype: "CDS", Name: "HA", Start: 4, Stop: 9, Codons: [][3]int{{4, 5, 6}, {7, 8, 9}}},
+	}
+
+	shifted := OffsetRegions(regions, "S2", 10)
+
+	desiredResult := []Region{
+		{Whichtype: "int", Start: 11, Stop: 13, Codons: [][3]int{}, Features: []Feature{{Type: "5'UTR", Name: "5'UTR", Start: 11, Stop: 13}}, Segment: "S2", Offset: 10},
+		{Whichtype: "CDS", Name: "HA", Start: 14, Stop: 19, Codons: [][3]int{{14, 15, 16}, {17, 18, 19}}, Features: []Feature{}, Segment: "S2", Offset: 10},
+	}
+	if !reflect.DeepEqual(shifted, desiredResult) {
+		t.Errorf("error in Test_OffsetRegions")
+	}
+	// the original regions are unchanged
+	if regions[1].Start != 4 || regions[1].Codons[0][0] != 4 || regions[0].Features[0].Start != 1 {
+		t.Errorf("error in Test_OffsetRegions")
+	}
+
+	if shifted[1].LabelPrefix() != "S2:" || regions[1].LabelPrefix() != "" {
+		t.Errorf("error in Test_OffsetRegions")
+	}
+}
+
+// the type, name, start and stop of each region, for comparing partitions
+type regionSpan struct {
+	Whichtype string
+	Name      string
+	Start     int
+	Stop      int
+}
+
+func spans(regions []Region) []regionSpan {
+	s := make([]regionSpan, 0)
+	for _, r := range regions {
+		s = append(s, regionSpan{r.Whichtype, r.Name, r.Start, r.Stop})
+	}
+	return s
+}
+
+func Test_GetRegions(t *testing.T) {
+	// a one-site spacer between two CDSs, and a 3' UTR at the end
+	regions, err := GetRegions("testdata/spacer.gb", "", false, 1, false, DefaultCDSNaming)
+	if err != nil {
+		t.Error(err)
+	}
+	desiredResult := []regionSpan{
+		{"CDS", "G1", 1, 9},
+		{"int", "", 10, 10},
+		{"CDS", "G2", 11, 28},
+		{"int", "", 29, 60},
+	}
+	if !reflect.DeepEqual(spans(regions), desiredResult) {
+		t.Errorf("error in Test_GetRegions")
+	}
+	if !reflect.DeepEqual(regions[2].Codons, [][3]int{{11, 12, 13}, {14, 15, 16}, {17, 18, 19}, {20, 21, 22}, {23, 24, 25}, {26, 27, 28}}) {
+		t.Errorf("error in Test_GetRegions")
+	}
+
+	// overlapping CDSs, a CDS on the minus strand, and a CDS with an intron
+	regions, err = GetRegions("testdata/overlap.gb", "", false, 1, false, DefaultCDSNaming)
+	if err != nil {
+		t.Error(err)
+	}
+	desiredResult = []regionSpan{
+		{"int", "", 1, 10},
+		{"CDS", "G1", 11, 40},
+		{"CDS", "G2", 12, 23},
+		{"int", "", 41, 42},
+		{"CDS", "G3", 43, 54},
+		{"int", "", 55, 60},
+		{"CDS", "G4", 61, 78},
+		{"int", "", 67, 69},
+		{"int", "", 79, 90},
+	}
+	if !reflect.DeepEqual(spans(regions), desiredResult) {
+		t.Errorf("error in Test_GetRegions")
+	}
+	if !regions[4].Complement || !reflect.DeepEqual(regions[4].Codons, [][3]int{{54, 53, 52}, {51, 50, 49}, {48, 47, 46}, {45, 44, 43}}) {
+		t.Errorf("error in Test_GetRegions")
+	}
+	if !reflect.DeepEqual(regions[6].Codons, [][3]int{{61, 62, 63}, {64, 65, 66}, {70, 71, 72}, {73, 74, 75}, {76, 77, 78}}) {
+		t.Errorf("error in Test_GetRegions")
+	}
+	if len(regions[0].Features) != 1 || regions[0].FeaturePrefix(5) != "UTR:" {
+		t.Errorf("error in Test_GetRegions")
+	}
+
+	// the whole genome as one region
+	regions, err = GetRegions("testdata/overlap.gb", "", true, 1, false, DefaultCDSNaming)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(spans(regions), []regionSpan{{"int", "", 1, 90}}) {
+		t.Errorf("error in Test_GetRegions")
+	}
+
+	// spliced CDSs in a GFF3 file, with codons that span their introns
+	regions, err = GetRegions("testdata/spliced.gff3", "", false, 1, false, DefaultCDSNaming)
+	if err != nil {
+		t.Error(err)
+	}
+	desiredResult = []regionSpan{
+		{"CDS", "G1", 1, 40},
+		{"int", "", 11, 14},
+		{"int", "", 41, 42},
+		{"CDS", "G2", 43, 59},
+		{"int", "", 48, 49},
+		{"int", "", 60, 60},
+	}
+	if !reflect.DeepEqual(spans(regions), desiredResult) {
+		t.Errorf("error in Test_GetRegions")
+	}
+	if len(regions[0].Codons) != 12 || regions[0].Codons[3] != [3]int{10, 15, 16} || regions[0].Codons[11] != [3]int{38, 39, 40} {
+		t.Errorf("error in Test_GetRegions")
+	}
+	if !regions[3].Complement || !reflect.DeepEqual(regions[3].Codons, [][3]int{{59, 58, 57}, {56, 55, 54}, {53, 52, 51}, {50, 47, 46}, {45, 44, 43}}) {
+		t.Errorf("error in Test_GetRegions")
+	}
+
+	// a CDS that runs off the end of the genome
+	_, err = GetRegions("testdata/outofrange.gb", "", false, 1, false, DefaultCDSNaming)
+	if err == nil {
+		t.Errorf("error in Test_GetRegions")
+	}
+}
+
+func Test_validateRegions(t *testing.T) {
+	regions := []Region{
+		{Whichtype: "int", Start: 1, Stop: 3},
+		{Whichtype: "CDS", Start: 4, Stop: 9, Codons: [][3]int{{4, 5, 6}, {7, 8, 9}}},
+	}
+	if validateRegions(regions, 9) != nil {
+		t.Errorf("error in Test_validateRegions")
+	}
+	// site 10 is in no region
+	if validateRegions(regions, 10) == nil {
+		t.Errorf("error in Test_validateRegions")
+	}
+	// site 4 is in an intergenic region and a CDS
+	regions[0].Stop = 4
+	if validateRegions(regions, 9) == nil {
+		t.Errorf("error in Test_validateRegions")
+	}
+
+	// a codon that spans an intron, so sites 6 and 7 are intergenic
+	regions = []Region{
+		{Whichtype: "CDS", Start: 1, Stop: 9, Codons: [][3]int{{1, 2, 3}, {4, 5, 8}}},
+		{Whichtype: "int", Start: 6, Stop: 7},
+		{Whichtype: "int", Start: 9, Stop: 9},
+	}
+	if validateRegions(regions, 9) != nil {
+		t.Errorf("error in Test_validateRegions")
+	}
+	// and one that is out of range
+	regions = []Region{
+		{Whichtype: "CDS", Start: 1, Stop: 5, Codons: [][3]int{{1, 2, 3}, {4, 5, 10}}},
+		{Whichtype: "int", Start: 6, Stop: 9},
+	}
+	if validateRegions(regions, 9) == nil {
+		t.Errorf("error in Test_validateRegions")
+	}
+}
+
+func Test_ParseLocation(t *testing.T) {
+	positions, complement, err := ParseLocation("complement(join(70..78,61..66))")
+	if err != nil {
+		t.Error(err)
+	}
+	if !complement || !reflect.DeepEqual(positions, []int{61, 66, 70, 78}) {
+		t.Errorf("error in Test_ParseLocation")
+	}
+
+	// the same CDS, with its ranges complemented one at a time and listed in reading order
+	positions, complement, err = ParseLocation("join(complement(70..78),complement(61..66))")
+	if err != nil {
+		t.Error(err)
+	}
+	if !complement || !reflect.DeepEqual(positions, []int{61, 66, 70, 78}) {
+		t.Errorf("error in Test_ParseLocation")
+	}
+
+	positions, complement, err = ParseLocation("<1..>30")
+	if err != nil {
+		t.Error(err)
+	}
+	if complement || !reflect.DeepEqual(positions, []int{1, 30}) {
+		t.Errorf("error in Test_ParseLocation")
+	}
+}
+
+func Test_GetRegionsMN908947(t *testing.T) {
+	// the SARS-CoV-2 reference, whose ORF1ab has a ribosomal slippage: site 13468 is read twice
+	regions, err := GetRegions("testdata/MN908947.3.gb", "", false, 1, true, DefaultCDSNaming)
+	if err != nil {
+		t.Error(err)
+	}
+
+	CDSs := make(map[string]Region)
+	nint := 0
+	for _, r := range regions {
+		switch r.Whichtype {
+		case "CDS":
+			CDSs[r.Name] = r
+		case "int":
+			nint++
+		}
+	}
+	if len(regions) != 23 || len(CDSs) != 12 || nint != 11 {
+		t.Errorf("error in Test_GetRegionsMN908947")
+	}
+
+	desiredCodons := map[string]int{"orf1ab": 7097, "orf1ab_2": 4406, "S": 1274, "ORF7b": 44, "N": 420, "ORF10": 39}
+	for name, n := range desiredCodons {
+		if len(CDSs[name].Codons) != n {
+			t.Errorf("error in Test_GetRegionsMN908947")
+		}
+	}
+
+	ORF1ab := CDSs["orf1ab"]
+	if ORF1ab.Start != 266 || ORF1ab.Stop != 21555 {
+		t.Errorf("error in Test_GetRegionsMN908947")
+	}
+	if ORF1ab.Codons[4400] != [3]int{13466, 13467, 13468} || ORF1ab.Codons[4401] != [3]int{13468, 13469, 13470} {
+		t.Errorf("error in Test_GetRegionsMN908947")
+	}
+
+	// nsp12 starts before the slippage, so it isn't in ORF1a, and nsp11 ends after it, so it isn't in ORF1ab
+	desiredPeptides := []Peptide{{"nsp1", 1, 180}, {"nsp12", 4393, 5324}, {"nsp16", 6799, 7096}}
+	if !reflect.DeepEqual(ORF1ab.Peptides, desiredPeptides) {
+		t.Errorf("error in Test_GetRegionsMN908947")
+	}
+	if !reflect.DeepEqual(CDSs["orf1ab_2"].Peptides, []Peptide{{"nsp1", 1, 180}, {"nsp11", 4393, 4405}}) {
+		t.Errorf("error in Test_GetRegionsMN908947")
+	}
+	if name, residue := ORF1ab.Residue(4401); name != "nsp12" || residue != 9 {
+		t.Errorf("error in Test_GetRegionsMN908947")
+	}
+}
+
+func Test_Complement(t *testing.T) {
+	tests := []struct {
+		seq                      string
+		desiredComplement        string
+		desiredReverseComplement string
+	}{
+		{"ATG", "TAC", "CAT"},
+		{"acgn", "TGCN", "NCGT"},
+		// ambiguity codes and gaps are complemented too, and anything else is N
+		{"RY-X", "YR-N", "N-RY"},
+	}
+
+	for _, test := range tests {
+		if Complement(test.seq) != test.desiredComplement || ReverseComplement(test.seq) != test.desiredReverseComplement {
+			t.Errorf("error in Test_Complement")
+		}
+	}
+}
+
+func Test_CodonSites(t *testing.T) {
+	tests := []struct {
+		location      string
+		desiredResult [][3]int
+	}{
+		{"1..6", [][3]int{{1, 2, 3}, {4, 5, 6}}},
+		{"complement(1..6)", [][3]int{{6, 5, 4}, {3, 2, 1}}},
+		// codons that span an intron, in both phases
+		{"join(1..10,15..19)", [][3]int{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10, 15, 16}, {17, 18, 19}}},
+		{"complement(join(43..47,50..59))", [][3]int{{59, 58, 57}, {56, 55, 54}, {53, 52, 51}, {50, 47, 46}, {45, 44, 43}}},
+		// not a whole number of codons
+		{"join(1..10,15..20)", nil},
+	}
+
+	for _, test := range tests {
+		positions, complement, err := ParseLocation(test.location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codons, err := CodonSites(positions, complement)
+		if test.desiredResult == nil {
+			if err == nil {
+				t.Errorf("error in Test_CodonSites")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(codons, test.desiredResult) {
+			t.Errorf("error in Test_CodonSites")
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package annotation
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// FastaRecord is one record of a fasta file
+type FastaRecord struct {
+	ID  string // the first word of the header
+	Seq string
+}
+
+// ReadFasta reads the records of a fasta file whose IDs wanted returns true for, in the order they are in the file,
+// and stops once it has n of them (if n > 0). If wanted is nil, every record is read. Sequences can be wrapped, or on
+// one (long) line
+func ReadFasta(fastaFile string, wanted func(ID string) bool, n int) ([]FastaRecord, error) {
+
+	records := make([]FastaRecord, 0)
+
+	err := scanFasta(fastaFile, wanted, func(r FastaRecord) bool {
+		records = append(records, r)
+		return n <= 0 || len(records) < n
+	})
+	if err != nil {
+		return []FastaRecord{}, err
+	}
+
+	return records, nil
+}
+
+// StreamFasta sends every record of a fasta file (an alignment) down cFR, with its sequence in upper case, then true
+// down cDone. If the file can't be read, the error is sent down cErr instead
+func StreamFasta(fastaFile string, cFR chan FastaRecord, cErr chan error, cDone chan bool) {
+
+	err := scanFasta(fastaFile, nil, func(r FastaRecord) bool {
+		r.Seq = strings.ToUpper(r.Seq)
+		cFR <- r
+		return true
+	})
+	if err != nil {
+		cErr <- err
+		return
+	}
+
+	cDone <- true
+}
+
+// scanFasta passes the wanted records of a fasta file to keep, in order, until keep returns false
+func scanFasta(fastaFile string, wanted func(ID string) bool, keep func(FastaRecord) bool) error {
+
+	f, err := os.Open(fastaFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var id string
+	var wantedID bool
+	var seqBuffer strings.Builder
+	finish := func() bool {
+		more := true
+		if wantedID {
+			more = keep(FastaRecord{ID: id, Seq: seqBuffer.String()})
+		}
+		seqBuffer.Reset()
+		return more
+	}
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 1024*1024), 1024*1024*1024)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '>' {
+			if !finish() {
+				return nil
+			}
+			id = ""
+			if fields := strings.Fields(line[1:]); len(fields) > 0 {
+				id = fields[0]
+			}
+			wantedID = wanted == nil || wanted(id)
+			continue
+		}
+		if wantedID {
+			seqBuffer.WriteString(line)
+		}
+	}
+
+	err = s.Err()
+	if err != nil {
+		return err
+	}
+
+	finish()
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package annotation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ReadFasta(t *testing.T) {
+	// a sequence on one line that is longer than bufio.Scanner's default buffer, and a wrapped one
+	long := strings.Repeat("ACGT", 100000)
+	fastaFile := filepath.Join(t.TempDir(), "seqs.fasta")
+	err := os.WriteFile(fastaFile, []byte(">a description\n"+long+"\n>b\nAC\nGT\n\n>c\nttt\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		wanted        func(ID string) bool
+		n             int
+		desiredResult []FastaRecord
+	}{
+		{nil, 0, []FastaRecord{{"a", long}, {"b", "ACGT"}, {"c", "ttt"}}},
+		{nil, 1, []FastaRecord{{"a", long}}},
+		{func(ID string) bool { return ID != "a" }, 0, []FastaRecord{{"b", "ACGT"}, {"c", "ttt"}}},
+		{func(ID string) bool { return ID == "d" }, 0, []FastaRecord{}},
+	}
+
+	for _, test := range tests {
+		records, err := ReadFasta(fastaFile, test.wanted, test.n)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(records, test.desiredResult) {
+			t.Errorf("error in Test_ReadFasta")
+		}
+	}
+}
+
+func Test_StreamFasta(t *testing.T) {
+	fastaFile := filepath.Join(t.TempDir(), "aln.fasta")
+	err := os.WriteFile(fastaFile, []byte(">a\nacgt\n>b\nAC\nNN\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cFR := make(chan FastaRecord)
+	cErr := make(chan error)
+	cDone := make(chan bool)
+	go StreamFasta(fastaFile, cFR, cErr, cDone)
+
+	records := make([]FastaRecord, 0)
+	for done := false; !done; {
+		select {
+		case r := <-cFR:
+			records = append(records, r)
+		case err := <-cErr:
+			t.Fatal(err)
+		case <-cDone:
+			done = true
+		}
+	}
+
+	desiredResult := []FastaRecord{{"a", "ACGT"}, {"b", "ACNN"}}
+	if !reflect.DeepEqual(records, desiredResult) {
+		t.Errorf("error in Test_StreamFasta")
+	}
+
+	go StreamFasta(filepath.Join(t.TempDir(), "missing.fasta"), cFR, cErr, cDone)
+	if <-cErr == nil {
+		t.Errorf("error in Test_StreamFasta")
+	}
+}
@@ -0,0 +1,134 @@
+package annotation
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cov-ert/gofasta/pkg/genbank"
+)
+
+// Feature is a (usually non-coding) functional element of the genome, such as a UTR or a stem-loop, from the
+// annotation or from a BED file. Changes at its sites are labelled with its name
+type Feature struct {
+	Type  string // the genbank feature key (e.g. "5'UTR"), or "bed"
+	Name  string // e.g. "TRS-L"
+	Chrom string // the sequence this feature is on, for BED features
+	Start int    // 1-based first position, inclusive
+	Stop  int    // 1-based last position, inclusive
+}
+
+// the genbank features that we label changes with
+var nonCodingFeatureKeys = []string{"misc_feature", "5'UTR", "3'UTR", "stem_loop", "regulatory"}
+
+// featureName gets a name for a non-coding feature: the first of its /standard_name, /label, the first clause
+// of its /note or its /regulatory_class that has no spaces in it, otherwise its feature key
+func featureName(F genbank.GenbankFeature) string {
+	candidates := []string{F.Info["standard_name"], F.Info["label"], strings.TrimSpace(strings.Split(F.Info["note"], ";")[0]), F.Info["regulatory_class"]}
+	for _, c := range candidates {
+		if len(c) > 0 && !strings.ContainsAny(c, " \t") {
+			return c
+		}
+	}
+	return F.Feature
+}
+
+// get the non-coding features from an annotation
+func getNonCodingFeatures(gb genbank.Genbank) ([]Feature, error) {
+	features := make([]Feature, 0)
+	for _, F := range gb.FEATURES {
+		isNonCoding := false
+		for _, key := range nonCodingFeatureKeys {
+			if F.Feature == key {
+				isNonCoding = true
+			}
+		}
+		if !isNonCoding {
+			continue
+		}
+		positions, _, err := ParseLocation(F.Pos)
+		if err != nil {
+			return []Feature{}, err
+		}
+		features = append(features, Feature{Type: F.Feature, Name: featureName(F), Start: positions[0], Stop: positions[len(positions)-1]})
+	}
+	return features, nil
+}
+
+// ReadBED reads the features in a BED file (chrom, 0-based start, end, and optionally name). Features without
+// a name are called chrom_start-end, in 1-based coordinates, because a ":" in a label ends its feature prefix
+func ReadBED(bedFile string) ([]Feature, error) {
+
+	f, err := os.Open(bedFile)
+	if err != nil {
+		return []Feature{}, err
+	}
+	defer f.Close()
+
+	features := make([]Feature, 0)
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			return []Feature{}, errors.New("badly formatted BED line (expected at least 3 tab-separated columns): " + line)
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return []Feature{}, errors.New("badly formatted BED start position: " + line)
+		}
+		stop, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return []Feature{}, errors.New("badly formatted BED end position: " + line)
+		}
+		if start < 0 || stop <= start {
+			return []Feature{}, errors.New("bad BED coordinates: " + line)
+		}
+		F := Feature{Type: "bed", Chrom: fields[0], Start: start + 1, Stop: stop}
+		if len(fields) > 3 && len(strings.TrimSpace(fields[3])) > 0 {
+			F.Name = strings.TrimSpace(fields[3])
+		} else {
+			F.Name = fields[0] + "_" + strconv.Itoa(F.Start) + "-" + strconv.Itoa(F.Stop)
+		}
+		features = append(features, F)
+	}
+
+	err = s.Err()
+	if err != nil {
+		return []Feature{}, err
+	}
+
+	return features, nil
+}
+
+// AttachFeatures adds each feature to the Features of every region that it overlaps
+func AttachFeatures(regions []Region, features []Feature) {
+	for i := range regions {
+		for _, F := range features {
+			if F.Start <= regions[i].Stop && F.Stop >= regions[i].Start {
+				regions[i].Features = append(regions[i].Features, F)
+			}
+		}
+	}
+}
+
+// FeaturePrefix is what the label for a nucleotide change at this (1-based) site starts with: the names of the
+// features the site is in, joined by "/", then ":". If the site isn't in any features, it is empty
+func (r Region) FeaturePrefix(pos int) string {
+	names := make([]string, 0)
+	for _, F := range r.Features {
+		if pos >= F.Start && pos <= F.Stop {
+			names = append(names, F.Name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.Join(names, "/") + ":"
+}
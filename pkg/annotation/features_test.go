@@ -0,0 +1,90 @@
+package annotation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cov-ert/gofasta/pkg/genbank"
+)
+
+func Test_ReadBED(t *testing.T) {
+	tests := []struct {
+		bed           string
+		desiredResult []Feature // nil for an error
+	}{
+		{"MN908947.3\t0\t265\t5'UTR\n", []Feature{{"bed", "5'UTR", "MN908947.3", 1, 265}}},
+		// features without a name are named by their 1-based coordinates, and headers and comments are skipped
+		{"track name=x\n# comment\nchr\t69\t72\n\nchr\t99\t100\t \n", []Feature{{"bed", "chr_70-72", "chr", 70, 72}, {"bed", "chr_100-100", "chr", 100, 100}}},
+		{"chr\t10\n", nil},
+		{"chr\tten\t20\n", nil},
+		{"chr\t20\t10\n", nil},
+	}
+
+	for _, test := range tests {
+		bedFile := filepath.Join(t.TempDir(), "features.bed")
+		err := os.WriteFile(bedFile, []byte(test.bed), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		features, err := ReadBED(bedFile)
+		if test.desiredResult == nil {
+			if err == nil {
+				t.Errorf("error in Test_ReadBED")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(features, test.desiredResult) {
+			t.Errorf("error in Test_ReadBED")
+		}
+	}
+}
+
+func Test_featureName(t *testing.T) {
+	tests := []struct {
+		F             genbank.GenbankFeature
+		desiredResult string
+	}{
+		{genbank.GenbankFeature{Feature: "stem_loop", Info: map[string]string{"standard_name": "s2m", "note": "stem-loop II"}}, "s2m"},
+		{genbank.GenbankFeature{Feature: "regulatory", Info: map[string]string{"label": "TRS-L"}}, "TRS-L"},
+		// the first clause of a note, if it's one word
+		{genbank.GenbankFeature{Feature: "misc_feature", Info: map[string]string{"note": "TRS-B; transcription regulatory sequence"}}, "TRS-B"},
+		{genbank.GenbankFeature{Feature: "regulatory", Info: map[string]string{"note": "a long note", "regulatory_class": "TATA_box"}}, "TATA_box"},
+		{genbank.GenbankFeature{Feature: "5'UTR", Info: map[string]string{"note": "a long note"}}, "5'UTR"},
+	}
+
+	for _, test := range tests {
+		if featureName(test.F) != test.desiredResult {
+			t.Errorf("error in Test_featureName")
+		}
+	}
+}
+
+func Test_FeaturePrefix(t *testing.T) {
+	regions := []Region{
+		{Whichtype: "int", Start: 1, Stop: 10},
+		{Whichtype: "CDS", Start: 11, Stop: 40},
+	}
+	AttachFeatures(regions, []Feature{{Name: "UTR", Start: 1, Stop: 10}, {Name: "TRS", Start: 8, Stop: 13}})
+
+	tests := []struct {
+		region        int
+		pos           int
+		desiredResult string
+	}{
+		{0, 5, "UTR:"},
+		{0, 9, "UTR/TRS:"},
+		{1, 12, "TRS:"},
+		{1, 20, ""},
+	}
+
+	for _, test := range tests {
+		if regions[test.region].FeaturePrefix(test.pos) != test.desiredResult {
+			t.Errorf("error in Test_FeaturePrefix")
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package annotation
+
+import "sort"
+
+// SiteChange is how a nucleotide change at one site has been classified in each of the reading frames
+// (overlapping CDSs) that the site is in
+type SiteChange struct {
+	Label      string // the nucleotide label for this change
+	Syn        int    // how many frames the change is synonymous in
+	NonSyn     int    // how many frames the change alters the amino acid in
+	Unresolved int    // how many frames the codons couldn't be translated unambiguously in
+}
+
+// Synonymous is true if the change is synonymous in every frame that it is in
+func (c *SiteChange) Synonymous() bool {
+	return c.Syn > 0 && c.NonSyn == 0 && c.Unresolved == 0
+}
+
+// SiteChanges collects the classifications of the nucleotide changes in CDSs on one branch, by 0-based site,
+// so that a change in overlapping CDSs is only labelled once
+type SiteChanges map[int]*SiteChange
+
+// Add records how the change at pos is classified in one frame. class is one of "syn", "nonsyn" or "unresolved"
+func (sc SiteChanges) Add(pos int, label string, class string) {
+	c, ok := sc[pos]
+	if !ok {
+		c = &SiteChange{Label: label}
+		sc[pos] = c
+	}
+	switch class {
+	case "syn":
+		c.Syn++
+	case "nonsyn":
+		c.NonSyn++
+	default:
+		c.Unresolved++
+	}
+}
+
+// Sites returns the sites with changes, in increasing order
+func (sc SiteChanges) Sites() []int {
+	sites := make([]int, 0, len(sc))
+	for pos := range sc {
+		sites = append(sites, pos)
+	}
+	sort.Ints(sites)
+	return sites
+}
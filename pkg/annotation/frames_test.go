@@ -0,0 +1,37 @@
+package annotation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_SiteChanges(t *testing.T) {
+	changes := make(SiteChanges)
+
+	// site 20 is in two frames, and is synonymous in only one of them. Site 5 is synonymous in both
+	changes.Add(20, "nuc=C21T", "syn")
+	changes.Add(20, "nuc=C21T", "nonsyn")
+	changes.Add(5, "nuc=A6G", "syn")
+	changes.Add(5, "nuc=A6G", "syn")
+	changes.Add(11, "nuc=G12R", "unresolved")
+
+	if !reflect.DeepEqual(changes.Sites(), []int{5, 11, 20}) {
+		t.Errorf("error in Test_SiteChanges")
+	}
+
+	tests := []struct {
+		pos           int
+		desiredResult SiteChange
+		synonymous    bool
+	}{
+		{5, SiteChange{Label: "nuc=A6G", Syn: 2}, true},
+		{11, SiteChange{Label: "nuc=G12R", Unresolved: 1}, false},
+		{20, SiteChange{Label: "nuc=C21T", Syn: 1, NonSyn: 1}, false},
+	}
+
+	for _, test := range tests {
+		if !reflect.DeepEqual(*changes[test.pos], test.desiredResult) || changes[test.pos].Synonymous() != test.synonymous {
+			t.Errorf("error in Test_SiteChanges")
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package annotation
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the NCBI genetic codes (https://www.ncbi.nlm.nih.gov/Taxonomy/Utils/wprintgc.cgi), as the amino acids of the
+// 64 codons with the bases in the order TCAG at each position (TTT, TTC, TTA, TTG, TCT, ...)
+var geneticCodes = map[int]string{
+	1:  "FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // standard
+	2:  "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSS**VVVVAAAADDEEGGGG", // vertebrate mitochondrial
+	3:  "FFLLSSSSYY**CCWWTTTTPPPPHHQQRRRRIIMMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // yeast mitochondrial
+	4:  "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // mold, protozoan and coelenterate mitochondrial, mycoplasma/spiroplasma
+	5:  "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSSSSVVVVAAAADDEEGGGG", // invertebrate mitochondrial
+	6:  "FFLLSSSSYYQQCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // ciliate, dasycladacean and hexamita nuclear
+	9:  "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNNKSSSSVVVVAAAADDEEGGGG", // echinoderm and flatworm mitochondrial
+	10: "FFLLSSSSYY**CCCWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // euplotid nuclear
+	11: "FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // bacterial, archaeal and plant plastid
+	12: "FFLLSSSSYY**CC*WLLLSPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // alternative yeast nuclear
+	13: "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSSGGVVVVAAAADDEEGGGG", // ascidian mitochondrial
+	14: "FFLLSSSSYYY*CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNNKSSSSVVVVAAAADDEEGGGG", // alternative flatworm mitochondrial
+	16: "FFLLSSSSYY*LCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // chlorophycean mitochondrial
+	21: "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNNKSSSSVVVVAAAADDEEGGGG", // trematode mitochondrial
+	22: "FFLLSS*SYY*LCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // scenedesmus obliquus mitochondrial
+	23: "FF*LSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // thraustochytrium mitochondrial
+	24: "FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSSKVVVVAAAADDEEGGGG", // rhabdopleuridae mitochondrial
+	25: "FFLLSSSSYY**CCGWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // candidate division SR1 and gracilibacteria
+	26: "FFLLSSSSYY**CC*WLLLAPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // pachysolen tannophilus nuclear
+	27: "FFLLSSSSYYQQCCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // karyorelict nuclear
+	28: "FFLLSSSSYYQQCCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // condylostoma nuclear
+	29: "FFLLSSSSYYYYCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // mesodinium nuclear
+	30: "FFLLSSSSYYEECC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // peritrich nuclear
+	31: "FFLLSSSSYYEECCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG", // blastocrithidia nuclear
+	33: "FFLLSSSSYYY*CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSSKVVVVAAAADDEEGGGG", // cephalodiscidae mitochondrial
+}
+
+// the nucleotides that each IUPAC code stands for
+var iupacNucs = map[byte]string{
+	'A': "A", 'C': "C", 'G': "G", 'T': "T",
+	'M': "AC", 'R': "AG", 'W': "AT", 'S': "CG", 'Y': "CT", 'K': "GT",
+	'V': "ACG", 'H': "ACT", 'D': "AGT", 'B': "CGT", 'N': "ACGT",
+}
+
+// ValidGeneticCode returns an error if table isn't the number of an NCBI genetic code
+func ValidGeneticCode(table int) error {
+	if _, ok := geneticCodes[table]; !ok {
+		return errors.New("unknown genetic code (transl_table): " + strconv.Itoa(table))
+	}
+	return nil
+}
+
+// GeneticCode returns a map from (unambiguous) codon to amino acid under an NCBI genetic code
+func GeneticCode(table int) (map[string]string, error) {
+	err := ValidGeneticCode(table)
+	if err != nil {
+		return map[string]string{}, err
+	}
+
+	bases := "TCAG"
+	m := make(map[string]string)
+	for i, aa := range geneticCodes[table] {
+		codon := string([]byte{bases[i/16], bases[(i/4)%4], bases[i%4]})
+		m[codon] = string(aa)
+	}
+
+	return m, nil
+}
+
+var codonDicts = make(map[int]map[string]string)
+var codonDictsLock sync.Mutex
+
+// CodonDict returns a map from codon to amino acid under an NCBI genetic code, which also includes every codon with
+// IUPAC ambiguity codes that can only code for one amino acid (e.g. GAR -> E in the standard code). Codons that aren't
+// in the map can't be translated unambiguously. The table should have been checked with ValidGeneticCode: the map
+// for an unknown table is empty
+func CodonDict(table int) map[string]string {
+
+	codonDictsLock.Lock()
+	defer codonDictsLock.Unlock()
+
+	if m, ok := codonDicts[table]; ok {
+		return m
+	}
+
+	m := make(map[string]string)
+	code, err := GeneticCode(table)
+	if err == nil {
+		for c1 := range iupacNucs {
+			for c2 := range iupacNucs {
+				for c3 := range iupacNucs {
+					codon := string([]byte{c1, c2, c3})
+					if aa, ok := translateAmbiguous(codon, code); ok {
+						m[codon] = aa
+					}
+				}
+			}
+		}
+	}
+	codonDicts[table] = m
+
+	return m
+}
+
+// translate a codon with IUPAC ambiguity codes, if all the codons it could be translate to the same amino acid
+func translateAmbiguous(codon string, code map[string]string) (string, bool) {
+	codons := []string{""}
+	for i := 0; i < len(codon); i++ {
+		temp := make([]string, 0)
+		for _, c := range codons {
+			for _, nuc := range iupacNucs[codon[i]] {
+				temp = append(temp, c+string(nuc))
+			}
+		}
+		codons = temp
+	}
+
+	aa := ""
+	for _, c := range codons {
+		switch {
+		case aa == "":
+			aa = code[c]
+		case code[c] != aa:
+			return "", false
+		}
+	}
+
+	return aa, len(aa) > 0
+}
+
+// TranslTable gets the genetic code of a CDS from its /transl_table qualifier, or the default if it doesn't have one
+func TranslTable(info map[string]string, defaultTable int) (int, error) {
+	s, ok := info["transl_table"]
+	if !ok {
+		return defaultTable, nil
+	}
+	table, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, errors.New("badly formatted transl_table: " + s)
+	}
+	return table, ValidGeneticCode(table)
+}
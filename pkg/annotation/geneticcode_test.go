@@ -0,0 +1,99 @@
+package annotation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_GeneticCode(t *testing.T) {
+	tests := []struct {
+		table         int
+		codons        []string
+		desiredResult []string // the amino acids of the codons, or nil for an error
+	}{
+		{1, []string{"ATG", "TGA", "ATA", "AGA"}, []string{"M", "*", "I", "R"}},
+		// the vertebrate mitochondrial code
+		{2, []string{"ATG", "TGA", "ATA", "AGA"}, []string{"M", "W", "M", "*"}},
+		{11, []string{"ATG", "TGA", "ATA", "AGA"}, []string{"M", "*", "I", "R"}},
+		{7, []string{}, nil},
+		{0, []string{}, nil},
+	}
+
+	for _, test := range tests {
+		code, err := GeneticCode(test.table)
+		if test.desiredResult == nil {
+			if err == nil || ValidGeneticCode(test.table) == nil {
+				t.Errorf("error in Test_GeneticCode")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		if len(code) != 64 {
+			t.Errorf("error in Test_GeneticCode")
+		}
+		aas := make([]string, 0)
+		for _, codon := range test.codons {
+			aas = append(aas, code[codon])
+		}
+		if !reflect.DeepEqual(aas, test.desiredResult) {
+			t.Errorf("error in Test_GeneticCode")
+		}
+	}
+}
+
+func Test_CodonDict(t *testing.T) {
+	tests := []struct {
+		table         int
+		codon         string
+		desiredResult string // "" if the codon can't be translated unambiguously
+	}{
+		{1, "GAA", "E"},
+		{1, "GAR", "E"},
+		{1, "GCN", "A"},
+		{1, "TRA", "*"},
+		{1, "GAN", ""},
+		{1, "NNN", ""},
+		{2, "TGR", "W"},
+		{1, "TGR", ""},
+		{2, "AGR", "*"},
+	}
+
+	for _, test := range tests {
+		if CodonDict(test.table)[test.codon] != test.desiredResult {
+			t.Errorf("error in Test_CodonDict")
+		}
+	}
+}
+
+func Test_TranslTable(t *testing.T) {
+	tests := []struct {
+		info          map[string]string
+		defaultTable  int
+		desiredResult int // 0 for an error
+	}{
+		{map[string]string{"gene": "M1"}, 1, 1},
+		{map[string]string{"gene": "M1"}, 11, 11},
+		{map[string]string{"transl_table": "2"}, 1, 2},
+		{map[string]string{"transl_table": " 11 "}, 1, 11},
+		{map[string]string{"transl_table": "7"}, 1, 0},
+		{map[string]string{"transl_table": "two"}, 1, 0},
+	}
+
+	for _, test := range tests {
+		table, err := TranslTable(test.info, test.defaultTable)
+		if (err != nil) != (test.desiredResult == 0) || (err == nil && table != test.desiredResult) {
+			t.Errorf("error in Test_TranslTable")
+		}
+	}
+
+	// a CDS's own /transl_table is used over the default
+	regions, err := GetRegions("testdata/mito.gb", "", false, 11, false, DefaultCDSNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 2 || regions[0].TranslTable != 2 || regions[1].TranslTable != 11 {
+		t.Errorf("error in Test_TranslTable")
+	}
+}
@@ -0,0 +1,393 @@
+package annotation
+
+import (
+	"bufio"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cov-ert/gofasta/pkg/genbank"
+)
+
+// ReadAnnotation reads a genome annotation, which can be in either GenBank or GFF3 format.
+// For GFF3, the sequence is taken from the ##FASTA section of the file if it has one,
+// otherwise from fastaFile
+func ReadAnnotation(annotationFile string, fastaFile string) (genbank.Genbank, error) {
+	isGFF, err := isGFF3(annotationFile)
+	if err != nil {
+		return genbank.Genbank{}, err
+	}
+	if isGFF {
+		return ReadGFF3(annotationFile, fastaFile)
+	}
+	return genbank.ReadGenBank(annotationFile)
+}
+
+// a GFF3 file either has a ##gff-version 3 header or a .gff/.gff3 extension
+func isGFF3(annotationFile string) (bool, error) {
+	ext := strings.ToLower(filepath.Ext(annotationFile))
+	if ext == ".gff" || ext == ".gff3" {
+		return true, nil
+	}
+
+	f, err := os.Open(annotationFile)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 {
+			continue
+		}
+		return strings.HasPrefix(line, "##gff-version"), nil
+	}
+
+	return false, s.Err()
+}
+
+// one line of a GFF3 file
+type gffRecord struct {
+	seqid      string
+	ftype      string
+	start      int
+	end        int
+	strand     string
+	phase      int
+	attributes map[string]string
+}
+
+// GFF3 feature types that have a GenBank feature key of a different name
+var gffFeatureKeys = map[string]string{
+	"five_prime_UTR":                        "5'UTR",
+	"three_prime_UTR":                       "3'UTR",
+	"mature_protein_region_of_CDS":          "mat_peptide",
+	"mature_protein_region":                 "mat_peptide",
+	"sequence_feature":                      "misc_feature",
+	"regulatory_region":                     "regulatory",
+	"transcriptional_cis_regulatory_region": "regulatory",
+}
+
+// ReadGFF3 reads a GFF3 format annotation and converts it to the same representation as a GenBank file,
+// so that it can be used wherever a GenBank file can. Lines of a CDS that share an ID, or (if they don't
+// have one) a Parent, are joined together as the exons of one CDS. The phase of the 5'-most exon is used
+// to trim the CDS to its first complete codon.
+func ReadGFF3(gffFile string, fastaFile string) (genbank.Genbank, error) {
+
+	f, err := os.Open(gffFile)
+	if err != nil {
+		return genbank.Genbank{}, err
+	}
+	defer f.Close()
+
+	records := make([]gffRecord, 0)
+	seqids := make([]string, 0)
+	seenSeqids := make(map[string]bool)
+	var seqBuffer strings.Builder
+	inFasta := false
+	seqFound := false
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 1024*1024), 1024*1024*1024)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if len(line) == 0 {
+			continue
+		}
+		if inFasta {
+			if line[0] == '>' {
+				fields := strings.Fields(line[1:])
+				// only one sequence is annotated (we check this below), so we keep the first record
+				// or the one that matches the features
+				seqFound = seqBuffer.Len() == 0 && (len(seqids) == 0 || (len(fields) > 0 && fields[0] == seqids[0]))
+				continue
+			}
+			if seqFound {
+				seqBuffer.WriteString(strings.TrimSpace(line))
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "##FASTA") {
+			inFasta = true
+			continue
+		}
+		if line[0] == '#' {
+			continue
+		}
+
+		record, err := parseGFFLine(line)
+		if err != nil {
+			return genbank.Genbank{}, err
+		}
+		if !seenSeqids[record.seqid] {
+			seqids = append(seqids, record.seqid)
+			seenSeqids[record.seqid] = true
+		}
+		records = append(records, record)
+	}
+	err = s.Err()
+	if err != nil {
+		return genbank.Genbank{}, err
+	}
+
+	if len(seqids) > 1 {
+		return genbank.Genbank{}, errors.New("GFF3 file annotates more than one sequence (use --segments for multi-segment genomes): " + gffFile)
+	}
+
+	gb := genbank.Genbank{}
+
+	switch {
+	case seqBuffer.Len() > 0:
+		gb.ORIGIN = []byte(seqBuffer.String())
+	case len(fastaFile) > 0:
+		seqid := ""
+		if len(seqids) > 0 {
+			seqid = seqids[0]
+		}
+		gb.ORIGIN, err = readGFFSequence(fastaFile, seqid)
+		if err != nil {
+			return genbank.Genbank{}, err
+		}
+	default:
+		return genbank.Genbank{}, errors.New("GFF3 file has no ##FASTA section, and no reference fasta file was provided (--gff-fasta): " + gffFile)
+	}
+
+	gb.FEATURES, err = gffToFeatures(records)
+	if err != nil {
+		return genbank.Genbank{}, err
+	}
+
+	return gb, nil
+}
+
+// parse one (non-comment) line of a GFF3 file
+func parseGFFLine(line string) (gffRecord, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 9 {
+		return gffRecord{}, errors.New("badly formatted GFF3 line (expected 9 tab-separated columns): " + line)
+	}
+
+	record := gffRecord{seqid: fields[0], ftype: fields[2], strand: fields[6], attributes: make(map[string]string)}
+
+	var err error
+	record.start, err = strconv.Atoi(fields[3])
+	if err != nil {
+		return gffRecord{}, errors.New("badly formatted GFF3 start position: " + line)
+	}
+	record.end, err = strconv.Atoi(fields[4])
+	if err != nil {
+		return gffRecord{}, errors.New("badly formatted GFF3 end position: " + line)
+	}
+	if record.start < 1 || record.end < record.start {
+		return gffRecord{}, errors.New("bad GFF3 coordinates: " + line)
+	}
+
+	if fields[7] != "." {
+		record.phase, err = strconv.Atoi(fields[7])
+		if err != nil || record.phase < 0 || record.phase > 2 {
+			return gffRecord{}, errors.New("badly formatted GFF3 phase: " + line)
+		}
+	}
+
+	for _, attribute := range strings.Split(fields[8], ";") {
+		attribute = strings.TrimSpace(attribute)
+		if len(attribute) == 0 || attribute == "." {
+			continue
+		}
+		kv := strings.SplitN(attribute, "=", 2)
+		if len(kv) != 2 {
+			return gffRecord{}, errors.New("badly formatted GFF3 attribute: " + attribute)
+		}
+		value, err := url.PathUnescape(kv[1])
+		if err != nil {
+			return gffRecord{}, errors.New("badly formatted GFF3 attribute: " + attribute)
+		}
+		record.attributes[kv[0]] = value
+	}
+
+	return record, nil
+}
+
+// read the sequence with this name from a fasta file (or the first record if seqid is empty, or if
+// there is only one record in the file)
+func readGFFSequence(fastaFile string, seqid string) ([]byte, error) {
+
+	records, err := ReadFasta(fastaFile, nil, 0)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	for _, r := range records {
+		if r.ID == seqid {
+			return []byte(r.Seq), nil
+		}
+	}
+	if len(records) == 1 || (len(seqid) == 0 && len(records) > 0) {
+		return []byte(records[0].Seq), nil
+	}
+
+	return []byte{}, errors.New("couldn't find the annotated sequence in the reference fasta file: " + seqid)
+}
+
+// convert GFF3 records to GenBank-style features, grouping the exons of CDSs
+func gffToFeatures(records []gffRecord) ([]genbank.GenbankFeature, error) {
+
+	byID := make(map[string]gffRecord)
+	for _, r := range records {
+		if ID, ok := r.attributes["ID"]; ok && r.ftype != "CDS" {
+			byID[ID] = r
+		}
+	}
+
+	features := make([]genbank.GenbankFeature, 0)
+
+	// the CDS lines, grouped by their ID (or Parent), in the order we first see them
+	cdsgroups := make(map[string][]gffRecord)
+	cdsorder := make([]string, 0)
+
+	for _, r := range records {
+		switch r.ftype {
+		case "CDS":
+			var key string
+			switch {
+			case len(r.attributes["ID"]) > 0:
+				key = r.attributes["ID"]
+			case len(r.attributes["Parent"]) > 0:
+				key = "Parent=" + r.attributes["Parent"]
+			default:
+				// a lone CDS line is a CDS of its own
+				key = "line=" + strconv.Itoa(len(cdsorder))
+			}
+			if _, ok := cdsgroups[key]; !ok {
+				cdsorder = append(cdsorder, key)
+			}
+			cdsgroups[key] = append(cdsgroups[key], r)
+		case "region", "exon", "mRNA", "transcript":
+			// these aren't needed, except to name the CDSs that are their children
+			continue
+		default:
+			ftype := r.ftype
+			if key, ok := gffFeatureKeys[ftype]; ok {
+				ftype = key
+			}
+			features = append(features, genbank.GenbankFeature{
+				Feature: ftype,
+				Pos:     gffPos([]gffRecord{r}, 0),
+				Info:    gffInfo(r, byID),
+			})
+		}
+	}
+
+	for _, key := range cdsorder {
+		exons := cdsgroups[key]
+		sort.SliceStable(exons, func(i, j int) bool { return exons[i].start < exons[j].start })
+
+		for _, e := range exons[1:] {
+			if e.strand != exons[0].strand {
+				return []genbank.GenbankFeature{}, errors.New("CDS has exons on both strands: " + key)
+			}
+		}
+
+		// the phase of the 5'-most exon says how many bases to skip to the first codon
+		phase := exons[0].phase
+		if exons[0].strand == "-" {
+			phase = exons[len(exons)-1].phase
+		}
+
+		features = append(features, genbank.GenbankFeature{
+			Feature: "CDS",
+			Pos:     gffPos(exons, phase),
+			Info:    gffInfo(exons[0], byID),
+		})
+	}
+
+	// keep the features in the order they are on the genome, like in a GenBank file
+	sort.SliceStable(features, func(i, j int) bool {
+		return firstPosition(features[i].Pos) < firstPosition(features[j].Pos)
+	})
+
+	return features, nil
+}
+
+// build a GenBank location string from some (sorted) GFF3 records, trimming the 5' end by phase
+func gffPos(exons []gffRecord, phase int) string {
+	ranges := make([]string, len(exons))
+	for i, e := range exons {
+		start := e.start
+		end := e.end
+		if phase > 0 && e.strand != "-" && i == 0 {
+			start += phase
+		}
+		if phase > 0 && e.strand == "-" && i == len(exons)-1 {
+			end -= phase
+		}
+		ranges[i] = strconv.Itoa(start) + ".." + strconv.Itoa(end)
+	}
+
+	pos := ranges[0]
+	if len(ranges) > 1 {
+		pos = "join(" + strings.Join(ranges, ",") + ")"
+	}
+	if exons[0].strand == "-" {
+		pos = "complement(" + pos + ")"
+	}
+
+	return pos
+}
+
+// the GenBank-style qualifiers of a feature. The gene name is taken from the feature itself if it has one,
+// otherwise from its Parent (e.g. an mRNA), or its Parent's Parent (e.g. a gene)
+func gffInfo(r gffRecord, byID map[string]gffRecord) map[string]string {
+	info := make(map[string]string)
+	for k, v := range r.attributes {
+		switch k {
+		case "ID", "Parent", "Name", "Dbxref", "Ontology_term":
+			continue
+		default:
+			info[k] = v
+		}
+	}
+	if _, ok := info["gene"]; ok {
+		return info
+	}
+
+	// walk up the Parents for a gene name
+	cur := r
+	for depth := 0; depth < 3; depth++ {
+		if gene, ok := cur.attributes["gene"]; ok {
+			info["gene"] = gene
+			return info
+		}
+		if cur.ftype == "gene" {
+			if name, ok := cur.attributes["Name"]; ok {
+				info["gene"] = name
+				return info
+			}
+		}
+		parent, ok := byID[strings.Split(cur.attributes["Parent"], ",")[0]]
+		if !ok {
+			break
+		}
+		cur = parent
+	}
+
+	if name, ok := r.attributes["Name"]; ok {
+		info["gene"] = name
+	}
+
+	return info
+}
+
+// the first position in a GenBank location string, for sorting features
+func firstPosition(pos string) int {
+	pos = strings.TrimPrefix(pos, "complement(")
+	pos = strings.TrimPrefix(pos, "join(")
+	n, _ := strconv.Atoi(strings.Split(pos, "..")[0])
+	return n
+}
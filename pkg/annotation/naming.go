@@ -0,0 +1,81 @@
+package annotation
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/cov-ert/gofasta/pkg/genbank"
+)
+
+// CDSNaming is how CDSs are named: by the first of the qualifiers in Priority that they have (or if they have
+// none of them, by their location, e.g. CDS_266-21555). Collisions is what to do when two CDSs get the same
+// (case-insensitive) name: "rename" the later ones by adding _2, _3 etc., or "error"
+type CDSNaming struct {
+	Priority   []string
+	Collisions string
+}
+
+// DefaultCDSNaming names CDSs by gene, then product, locus_tag and protein_id, and renames collisions
+var DefaultCDSNaming = CDSNaming{Priority: []string{"gene", "product", "locus_tag", "protein_id"}, Collisions: "rename"}
+
+// Check returns an error if the naming scheme is badly specified
+func (naming CDSNaming) Check() error {
+	if len(naming.Priority) == 0 {
+		return errors.New("no qualifiers to name CDSs by")
+	}
+	if naming.Collisions != "rename" && naming.Collisions != "error" {
+		return errors.New("unknown way of handling CDS name collisions: choose one of rename or error")
+	}
+	return nil
+}
+
+// NameCDSs returns the names of the CDS features in an annotation, in the order they appear in it
+func NameCDSs(features []genbank.GenbankFeature, naming CDSNaming) ([]string, error) {
+
+	err := naming.Check()
+	if err != nil {
+		return []string{}, err
+	}
+
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, F := range features {
+		if F.Feature != "CDS" {
+			continue
+		}
+
+		name := ""
+		for _, qualifier := range naming.Priority {
+			if v := strings.TrimSpace(F.Info[qualifier]); len(v) > 0 {
+				name = v
+				break
+			}
+		}
+		// if it has none of them, we name it by its location
+		if len(name) == 0 {
+			positions, _, err := ParseLocation(F.Pos)
+			if err != nil {
+				return []string{}, err
+			}
+			name = "CDS_" + strconv.Itoa(positions[0]) + "-" + strconv.Itoa(positions[len(positions)-1])
+		}
+
+		if seen[strings.ToLower(name)] {
+			if naming.Collisions == "error" {
+				return []string{}, errors.New("more than one CDS is called " + name + " (try a different --cds-name-priority, or --cds-collisions rename)")
+			}
+			n := 2
+			for seen[strings.ToLower(name+"_"+strconv.Itoa(n))] {
+				n++
+			}
+			name = name + "_" + strconv.Itoa(n)
+		}
+
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,48 @@
+package annotation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cov-ert/gofasta/pkg/genbank"
+)
+
+func Test_NameCDSs(t *testing.T) {
+	features := []genbank.GenbankFeature{
+		{Feature: "CDS", Pos: "1..12", Info: map[string]string{"gene": "ORF1ab", "product": "pp1ab", "locus_tag": "GU280_gp01"}},
+		{Feature: "mat_peptide", Pos: "1..6", Info: map[string]string{"product": "nsp1"}},
+		{Feature: "CDS", Pos: "1..9", Info: map[string]string{"gene": "orf1ab", "product": "pp1a", "locus_tag": "GU280_gp01"}},
+		{Feature: "CDS", Pos: "20..31", Info: map[string]string{"product": "surface glycoprotein", "protein_id": "QHD43416.1"}},
+		{Feature: "CDS", Pos: "join(40..45,50..55)", Info: map[string]string{}},
+	}
+
+	tests := []struct {
+		naming        CDSNaming
+		desiredResult []string // nil for an error
+	}{
+		// the second ORF1ab gets a number, whatever its case
+		{DefaultCDSNaming, []string{"ORF1ab", "orf1ab_2", "surface glycoprotein", "CDS_40-55"}},
+		{CDSNaming{Priority: []string{"product", "gene"}, Collisions: "error"}, []string{"pp1ab", "pp1a", "surface glycoprotein", "CDS_40-55"}},
+		{CDSNaming{Priority: []string{"protein_id"}, Collisions: "rename"}, []string{"CDS_1-12", "CDS_1-9", "QHD43416.1", "CDS_40-55"}},
+		{CDSNaming{Priority: []string{"locus_tag"}, Collisions: "rename"}, []string{"GU280_gp01", "GU280_gp01_2", "CDS_20-31", "CDS_40-55"}},
+		{CDSNaming{Priority: []string{"locus_tag"}, Collisions: "error"}, nil},
+		{CDSNaming{Priority: []string{}, Collisions: "rename"}, nil},
+		{CDSNaming{Priority: []string{"gene"}, Collisions: "ignore"}, nil},
+	}
+
+	for _, test := range tests {
+		names, err := NameCDSs(features, test.naming)
+		if test.desiredResult == nil {
+			if err == nil {
+				t.Errorf("error in Test_NameCDSs")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(names, test.desiredResult) {
+			t.Errorf("error in Test_NameCDSs")
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package annotation
+
+import (
+	"strings"
+
+	"github.com/cov-ert/gofasta/pkg/genbank"
+)
+
+// Peptide is a mature peptide (mat_peptide feature) of a polyprotein CDS
+type Peptide struct {
+	Name  string // e.g. "nsp12"
+	Start int    // 1-based first residue of the peptide in its CDS's numbering, inclusive
+	Stop  int    // 1-based last residue of the peptide in its CDS's numbering, inclusive
+}
+
+// PeptideName gets a name for a mat_peptide feature. We prefer short names, so this is the first of
+// its /standard_name, the first clause of its /note or its /product that has no spaces in it (e.g. "nsp12"
+// from /note="nsp12; NiRAN and RdRp"), otherwise its /product
+func PeptideName(info map[string]string) string {
+	candidates := []string{info["standard_name"], strings.TrimSpace(strings.Split(info["note"], ";")[0]), info["product"]}
+	for _, c := range candidates {
+		if len(c) > 0 && !strings.ContainsAny(c, " \t") {
+			return c
+		}
+	}
+	return info["product"]
+}
+
+// find the mat_peptide features that are in frame in each CDS, and add them to the CDS's Peptides
+func attachPeptides(cdsregions []Region, features []genbank.GenbankFeature) error {
+
+	for _, F := range features {
+		if F.Feature != "mat_peptide" {
+			continue
+		}
+
+		positions, complement, err := ParseLocation(F.Pos)
+		if err != nil {
+			return err
+		}
+
+		sites := LocationSites(positions, complement)
+		name := PeptideName(F.Info)
+
+		for i := range cdsregions {
+			if cdsregions[i].Complement != complement {
+				continue
+			}
+			j, ok := PeptideInCDS(cdsregions[i].Codons, sites)
+			if !ok {
+				continue
+			}
+			p := Peptide{Name: name, Start: j + 1, Stop: j + len(sites)/3}
+			if !hasPeptide(cdsregions[i].Peptides, p) {
+				cdsregions[i].Peptides = append(cdsregions[i].Peptides, p)
+			}
+		}
+	}
+
+	return nil
+}
+
+// PeptideInCDS finds a mature peptide's sites (in reading order) in the codons of a CDS, and returns the 0-based index
+// of the peptide's first codon. The peptide is only in the CDS if all of its sites are in the CDS's codons, in frame,
+// so a peptide that ends after a ribosomal slippage isn't in the CDS that doesn't slip, and vice versa
+func PeptideInCDS(codons [][3]int, sites []int) (int, bool) {
+	if len(sites) < 3 {
+		return 0, false
+	}
+	for j, codon := range codons {
+		if codon[0] != sites[0] {
+			continue
+		}
+		if len(sites) > 3*len(codons[j:]) {
+			return 0, false
+		}
+		for k, site := range sites {
+			if codons[j+k/3][k%3] != site {
+				return 0, false
+			}
+		}
+		return j, true
+	}
+	return 0, false
+}
+
+func hasPeptide(peptides []Peptide, p Peptide) bool {
+	for _, q := range peptides {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Residue gets the name and number that a residue of this CDS is labelled with: the mature peptide that the residue
+// is in and its position in that peptide, if the CDS has mature peptides, otherwise the CDS and the residue's position
+// in the CDS
+func (r Region) Residue(residue int) (string, int) {
+	for _, p := range r.Peptides {
+		if residue >= p.Start && residue <= p.Stop {
+			return p.Name, residue - p.Start + 1
+		}
+	}
+	return r.Name, residue
+}
@@ -0,0 +1,73 @@
+package annotation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_PeptideName(t *testing.T) {
+	tests := []struct {
+		info          map[string]string
+		desiredResult string
+	}{
+		{map[string]string{"standard_name": "nsp12", "note": "nsp12; NiRAN and RdRp", "product": "RNA-dependent RNA polymerase"}, "nsp12"},
+		{map[string]string{"note": "nsp12; NiRAN and RdRp", "product": "RNA-dependent RNA polymerase"}, "nsp12"},
+		{map[string]string{"note": "NiRAN and RdRp", "product": "RdRp"}, "RdRp"},
+		// if nothing is short, the product is used anyway
+		{map[string]string{"product": "RNA-dependent RNA polymerase"}, "RNA-dependent RNA polymerase"},
+	}
+
+	for _, test := range tests {
+		if PeptideName(test.info) != test.desiredResult {
+			t.Errorf("error in Test_PeptideName")
+		}
+	}
+}
+
+func Test_attachPeptides(t *testing.T) {
+	// the peptide at 11..16 isn't in frame in P, so it isn't attached
+	regions, err := GetRegions("testdata/polyprotein.gb", "", false, 1, true, DefaultCDSNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 2 || !reflect.DeepEqual(regions[0].Peptides, []Peptide{{"nsp1", 1, 3}, {"nsp2", 4, 6}}) || len(regions[1].Peptides) != 0 {
+		t.Errorf("error in Test_attachPeptides")
+	}
+
+	tests := []struct {
+		region  int
+		residue int
+		name    string
+		number  int
+	}{
+		{0, 2, "nsp1", 2},
+		{0, 4, "nsp2", 1},
+		{0, 6, "nsp2", 3},
+		{1, 1, "Q", 1},
+	}
+
+	for _, test := range tests {
+		name, number := regions[test.region].Residue(test.residue)
+		if name != test.name || number != test.number {
+			t.Errorf("error in Test_attachPeptides")
+		}
+	}
+
+	// without mature peptide numbering, residues are numbered by CDS
+	regions, err = GetRegions("testdata/polyprotein.gb", "", false, 1, false, DefaultCDSNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, number := regions[0].Residue(4); len(regions[0].Peptides) != 0 || name != "P" || number != 4 {
+		t.Errorf("error in Test_attachPeptides")
+	}
+
+	// on the minus strand, the first peptide is at the end of the CDS
+	regions, err = GetRegions("testdata/polyprotein_minus.gb", "", false, 1, true, DefaultCDSNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 2 || !reflect.DeepEqual(regions[1].Peptides, []Peptide{{"nsp1", 1, 3}, {"nsp2", 4, 6}}) {
+		t.Errorf("error in Test_attachPeptides")
+	}
+}
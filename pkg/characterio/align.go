@@ -5,13 +5,15 @@ import (
 	"errors"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"unicode"
 
-	"github.com/cov-ert/gofasta/pkg/fastaio"
 	"github.com/cov-ert/gofasta/pkg/genbank"
 
+	"github.com/benjamincjackson/ash/pkg/annotation"
 	"github.com/benjamincjackson/ash/pkg/bitsets"
 	"github.com/benjamincjackson/gotree/tree"
 )
@@ -25,11 +27,16 @@ type CharacterStruct struct {
 
 // variant contains information about a character used for typing it in an alignment
 type variant struct {
-	vtype   string // "snp" or "aa" or "del"
-	vpos    int    // 1-based start in alignment
+	vtype   string // "nuc", "aa", "del", "aadel", "mnv", "ins", or "nucallele", "aaallele", "delallele" for named mutations
+	vpos    int    // 1-based start in alignment (for amino acids, the lowest site of the codon)
 	vgene   string // for amino acids only
 	vres    int    // for amino acids only (residue number)
-	vlength int    // for deletions only
+	vlength int    // for deletions, mnvs and insertions only (in nucleotides)
+	vmut    string // for alleles only: the name of the mutation, e.g. "S:D614G"
+	valt    string // for alleles only: the derived allele
+	vcodon  [3]int // for amino acids only: the 1-based sites of the codon, in reading order
+	vcomp   bool   // for amino acids only: the CDS is on the minus strand, so codons are read as the complement
+	vtable  int    // for amino acids only: the NCBI genetic code of the CDS
 }
 
 type NodeStates struct {
@@ -37,145 +44,353 @@ type NodeStates struct {
 	States []byte // bit-encoded character states. Hopefully will parallelise over the first dimension of the array
 }
 
-func getCDSPosFromAnnotation(gb genbank.Genbank) map[string]string {
+// the codons and genetic code of one CDS in the annotation
+type cdsInfo struct {
+	codons     [][3]int // the 1-based sites of each codon, in reading order (see annotation.CodonSites)
+	complement bool     // true if the CDS is on the minus strand
+	table      int      // NCBI genetic code
+}
+
+// get the codons and genetic code of every CDS in the annotation, by (lower case) name (see annotation.NameCDSs).
+// CDSs without a /transl_table qualifier have the genetic code geneticCode. Mature peptides are included too, by
+// (lower case) peptide name, so that residues can be given in either polyprotein or mature peptide numbering
+func getCDSPosFromAnnotation(gb genbank.Genbank, geneticCode int, naming annotation.CDSNaming) (map[string]cdsInfo, error) {
+
+	m := make(map[string]cdsInfo)
+	cdss := make([]cdsInfo, 0)
 
-	m := make(map[string]string)
+	names, err := annotation.NameCDSs(gb.FEATURES, naming)
+	if err != nil {
+		return map[string]cdsInfo{}, err
+	}
 
+	i := 0
 	for _, F := range gb.FEATURES {
 		if F.Feature == "CDS" {
-			m[strings.ToLower(F.Info["gene"])] = F.Pos
+			table, err := annotation.TranslTable(F.Info, geneticCode)
+			if err != nil {
+				return map[string]cdsInfo{}, err
+			}
+			positions, complement, err := annotation.ParseLocation(F.Pos)
+			if err != nil {
+				return map[string]cdsInfo{}, err
+			}
+			codons, err := annotation.CodonSites(positions, complement)
+			if err != nil {
+				return map[string]cdsInfo{}, errors.New("CDS length is not a multiple of 3: " + names[i] + " (" + F.Pos + ")")
+			}
+			cds := cdsInfo{codons: codons, complement: complement, table: table}
+			m[strings.ToLower(names[i])] = cds
+			cdss = append(cdss, cds)
+			i++
+		}
+	}
+
+	for _, F := range gb.FEATURES {
+		if F.Feature != "mat_peptide" {
+			continue
+		}
+		name := strings.ToLower(annotation.PeptideName(F.Info))
+		if _, ok := m[name]; ok || len(name) == 0 {
+			continue
+		}
+		peptide, ok, err := peptideCodons(cdss, F)
+		if err != nil {
+			return map[string]cdsInfo{}, err
+		}
+		if ok {
+			m[name] = peptide
+		}
+	}
+
+	return m, nil
+}
+
+// get the codons of a mature peptide from the CDS that it is in frame in (see annotation.PeptideInCDS), which it has
+// the genetic code of. ok is false if the peptide isn't in frame in any CDS
+func peptideCodons(cdss []cdsInfo, peptide genbank.GenbankFeature) (cdsInfo, bool, error) {
+	positions, complement, err := annotation.ParseLocation(peptide.Pos)
+	if err != nil {
+		return cdsInfo{}, false, err
+	}
+	sites := annotation.LocationSites(positions, complement)
+
+	for _, cds := range cdss {
+		if cds.complement != complement {
+			continue
+		}
+		j, ok := annotation.PeptideInCDS(cds.codons, sites)
+		if !ok {
+			continue
 		}
+		return cdsInfo{codons: cds.codons[j : j+len(sites)/3], complement: complement, table: cds.table}, true, nil
 	}
+	return cdsInfo{}, false, nil
+}
 
-	return m
+// get the sites of the codon of an amino acid residue of a CDS, in reading order
+func residueCodon(cds cdsInfo, residue int) ([3]int, error) {
+	if residue < 1 || residue > len(cds.codons) {
+		return [3]int{}, errors.New("residue " + strconv.Itoa(residue) + " is out of range of the CDS, which has " + strconv.Itoa(len(cds.codons)) + " codons")
+	}
+	return cds.codons[residue-1], nil
 }
 
-// get the 1-based start position of the amino acid residue in question
-func getAAStartPos(residue_pos int, nuc_pos_string string) (int, error) {
+// get the lowest 1-based site of the codons of a run of residues
+func firstCodonPos(start int, stop int, cds cdsInfo) (int, error) {
+	first, err := residueCodon(cds, start)
+	if err != nil {
+		return 0, err
+	}
+	last, err := residueCodon(cds, stop)
+	if err != nil {
+		return 0, err
+	}
+	if lowestSite(last) < lowestSite(first) {
+		return lowestSite(last), nil
+	}
+	return lowestSite(first), nil
+}
 
-	p := 0
-	A := make([]int, 0)
+// get the lowest of the sites of a codon
+func lowestSite(codon [3]int) int {
+	low := codon[0]
+	for _, site := range codon[1:] {
+		if site < low {
+			low = site
+		}
+	}
+	return low
+}
 
-	if nuc_pos_string[0:4] == "join" {
-		nuc_pos_string = strings.TrimLeft(nuc_pos_string, "join(")
-		nuc_pos_string = strings.TrimRight(nuc_pos_string, ")")
-		ranges := strings.Split(nuc_pos_string, ",")
-		for _, x := range ranges {
-			y := strings.Split(x, "..")
-			for _, z := range y {
-				temp, err := strconv.Atoi(z)
-				if err != nil {
-					return 0, err
-				}
-				A = append(A, temp)
-			}
+// get the highest of the sites of a codon
+func highestSite(codon [3]int) int {
+	high := codon[0]
+	for _, site := range codon[1:] {
+		if site > high {
+			high = site
 		}
-	} else {
-		y := strings.Split(nuc_pos_string, "..")
-		for _, z := range y {
-			temp, err := strconv.Atoi(z)
+	}
+	return high
+}
+
+// parse "a" or "a-b" into a 1-based, inclusive range of positions
+func parseRange(s string) (int, int, error) {
+
+	fields := strings.Split(s, "-")
+
+	start, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch len(fields) {
+	case 1:
+		return start, start, nil
+	case 2:
+		stop, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, 0, err
+		}
+		if stop < start {
+			return 0, 0, errors.New("badly formatted range (stop is before start): " + s)
+		}
+		return start, stop, nil
+	}
+
+	return 0, 0, errors.New("badly formatted range: " + s)
+}
+
+// the types of variant that can start a line of the variants config. Anything else is a gene name
+var configKeywords = []string{"nuc", "aa", "del", "aadel", "mnv", "ins"}
+
+// is this line of the variants config a named mutation (e.g. S:D614G, nuc:C241T, ORF1a:del3675-3677)?
+func isMutationNotation(fields []string) bool {
+	if len(fields) != 2 {
+		return false
+	}
+	if strings.HasPrefix(fields[1], "del") {
+		return fields[0] != "del" && fields[0] != "aadel"
+	}
+	return !stringInArray(fields[0], configKeywords) || (fields[0] == "nuc" && len(fields[1]) > 0 && !unicode.IsDigit(rune(fields[1][0])))
+}
+
+// parse a mutation like D614G or C241T into its ancestral allele, position and derived allele
+func parseMutation(mutation string) (string, int, string, error) {
+	if len(mutation) < 3 {
+		return "", 0, "", errors.New("badly formatted mutation: " + mutation)
+	}
+	anc := mutation[0:1]
+	alt := mutation[len(mutation)-1:]
+	pos, err := strconv.Atoi(mutation[1 : len(mutation)-1])
+	if err != nil {
+		return "", 0, "", errors.New("badly formatted mutation: " + mutation)
+	}
+	return anc, pos, alt, nil
+}
+
+// parse a named mutation from the variants config into a binary character, whose states are whether the
+// derived allele is present or absent
+func parseMutationLine(line string, cdspos map[string]cdsInfo) (CharacterStruct, error) {
+
+	fields := strings.Split(line, ":")
+
+	if fields[0] == "nuc" {
+		if strings.HasPrefix(fields[1], "del") {
+			start, stop, err := parseRange(strings.TrimPrefix(fields[1], "del"))
 			if err != nil {
-				return 0, err
+				return CharacterStruct{}, err
 			}
-			A = append(A, temp)
+			return CharacterStruct{V: variant{vtype: "delallele", vmut: line, vpos: start, vlength: stop - start + 1}}, nil
+		}
+		_, pos, alt, err := parseMutation(fields[1])
+		if err != nil {
+			return CharacterStruct{}, err
 		}
+		return CharacterStruct{V: variant{vtype: "nucallele", vmut: line, vpos: pos, valt: alt}}, nil
 	}
 
-	// if the length of A is not a non-zero multiple of 2, then something has gone wrong
-	if len(A)%2 != 0 || len(A) == 0 {
-		return 0, errors.New("Error parsing CDS positions")
+	if cdspos == nil {
+		return CharacterStruct{}, errors.New("you must provide a --genbank file to type amino acids: " + line)
+	}
+	gene := strings.ToLower(fields[0])
+	cds, ok := cdspos[gene]
+	if !ok {
+		return CharacterStruct{}, errors.New("could not parse config line (unknown gene): " + line)
 	}
 
-	if len(A)/2 > 1 {
-		for i := 0; i < len(A); i += 2 {
-			if A[i]+((residue_pos-1)*3) > A[i+1] {
-				residue_pos = residue_pos - ((A[i+1] - A[i] + 1) / 3)
-				continue
-			} else {
-				p = A[i] + ((residue_pos - 1) * 3)
-				break
-			}
+	if strings.HasPrefix(fields[1], "del") {
+		start, stop, err := parseRange(strings.TrimPrefix(fields[1], "del"))
+		if err != nil {
+			return CharacterStruct{}, err
 		}
-	} else {
-		p = A[0] + ((residue_pos - 1) * 3)
+		pos, err := firstCodonPos(start, stop, cds)
+		if err != nil {
+			return CharacterStruct{}, err
+		}
+		return CharacterStruct{V: variant{vtype: "delallele", vmut: line, vgene: gene, vres: start, vpos: pos, vlength: (stop - start + 1) * 3}}, nil
 	}
 
-	// if the residue pos is either still 0 or out of range, the something has gone wrong
-	if p == 0 || p > A[len(A)-1]-2 {
-		return 0, errors.New("Error parsing CDS positions2")
+	_, residuepos, alt, err := parseMutation(fields[1])
+	if err != nil {
+		return CharacterStruct{}, err
+	}
+	codon, err := residueCodon(cds, residuepos)
+	if err != nil {
+		return CharacterStruct{}, err
 	}
 
-	return p, nil
+	return CharacterStruct{V: variant{vtype: "aaallele", vmut: line, vgene: gene, vres: residuepos, vpos: lowestSite(codon), vcodon: codon, valt: alt, vcomp: cds.complement, vtable: cds.table}}, nil
 }
 
-// read a config file of variants to type and take also as input information about the positions
-// of CDSes, and return an array of variant information structs that will be used to type the alignment
-func readConfig(configFile string, cdspos map[string]string) ([]CharacterStruct, error) {
+// parse one line of the variants config into the character(s) it describes. Lines can be:
+//
+//	nuc:pos, or nuc:start-stop for one nucleotide character per site in a range
+//	aa:gene:residue, or aa:gene:* for every residue in a gene
+//	del:pos:length
+//	aadel:gene:residue:nresidues for a deletion of whole codons
+//	mnv:pos:length for a multi-nucleotide haplotype
+//	ins:pos:length for insertion columns (relative to the reference) in a gapped-reference alignment. pos is
+//	the first column, or with a reference row (see RefCoords), the reference position the insertion follows
+//	gene:D614G, nuc:C241T, gene:del3675-3677 or nuc:del686-694 for a named mutation, which is typed as a
+//	binary character (the derived allele is present or absent)
+//
+// cdspos can be nil if there is no annotation, in which case amino acid lines are an error
+func parseConfigLine(line string, cdspos map[string]cdsInfo) ([]CharacterStruct, error) {
 
 	csa := make([]CharacterStruct, 0)
 
-	f, err := os.Open(configFile)
-	if err != nil {
-		return []CharacterStruct{}, err
-	}
-	defer f.Close()
+	fields := strings.Split(line, ":")
 
-	s := bufio.NewScanner(f)
-	for s.Scan() {
-		line := s.Text()
-		fields := strings.Split(line, ":")
+	if len(fields) < 2 {
+		return []CharacterStruct{}, errors.New("could not parse config line (too few fields): " + line)
+	}
 
-		if len(fields) < 2 {
-			return []CharacterStruct{}, errors.New("could not parse config line (too few fields): " + line)
+	if isMutationNotation(fields) {
+		cs, err := parseMutationLine(line, cdspos)
+		if err != nil {
+			return []CharacterStruct{}, err
 		}
+		return []CharacterStruct{cs}, nil
+	}
 
-		switch fields[0] {
-		case "aa":
-			gene := strings.ToLower(fields[1])
-			residuepos, err := strconv.Atoi(fields[2])
-			if err != nil {
-				return []CharacterStruct{}, err
-			}
-			cds_pos_string, ok := cdspos[gene]
-			if !ok {
-				return []CharacterStruct{}, errors.New("could not parse config line: " + line)
+	switch fields[0] {
+	case "aa", "aadel":
+		if cdspos == nil {
+			return []CharacterStruct{}, errors.New("you must provide a --genbank file to type amino acids: " + line)
+		}
+		if (fields[0] == "aa" && len(fields) != 3) || (fields[0] == "aadel" && len(fields) != 4) {
+			return []CharacterStruct{}, errors.New("could not parse config line (wrong number of fields): " + line)
+		}
+		gene := strings.ToLower(fields[1])
+		cds, ok := cdspos[gene]
+		if !ok {
+			return []CharacterStruct{}, errors.New("could not parse config line: " + line)
+		}
+		residues := make([]int, 0)
+		if fields[0] == "aa" && fields[2] == "*" {
+			for r := 1; r <= len(cds.codons); r++ {
+				residues = append(residues, r)
 			}
-			pos, err := getAAStartPos(residuepos, cds_pos_string)
+		} else {
+			residuepos, err := strconv.Atoi(fields[2])
 			if err != nil {
 				return []CharacterStruct{}, err
 			}
-			csa = append(csa, CharacterStruct{V: variant{vtype: "aa", vgene: gene, vpos: pos, vres: residuepos}})
-		case "nuc":
-			pos, err := strconv.Atoi(fields[1])
-			if err != nil {
-				return []CharacterStruct{}, err
+			residues = append(residues, residuepos)
+		}
+		for _, residuepos := range residues {
+			switch fields[0] {
+			case "aa":
+				codon, err := residueCodon(cds, residuepos)
+				if err != nil {
+					return []CharacterStruct{}, err
+				}
+				csa = append(csa, CharacterStruct{V: variant{vtype: "aa", vgene: gene, vpos: lowestSite(codon), vcodon: codon, vres: residuepos, vcomp: cds.complement, vtable: cds.table}})
+			case "aadel":
+				nresidues, err := strconv.Atoi(fields[3])
+				if err != nil {
+					return []CharacterStruct{}, err
+				}
+				pos, err := firstCodonPos(residuepos, residuepos+nresidues-1, cds)
+				if err != nil {
+					return []CharacterStruct{}, err
+				}
+				csa = append(csa, CharacterStruct{V: variant{vtype: "aadel", vgene: gene, vpos: pos, vres: residuepos, vlength: nresidues * 3}})
 			}
+		}
+	case "nuc":
+		start, stop, err := parseRange(fields[1])
+		if err != nil {
+			return []CharacterStruct{}, err
+		}
+		for pos := start; pos <= stop; pos++ {
 			csa = append(csa, CharacterStruct{V: variant{vtype: "nuc", vpos: pos}})
-		case "del":
-			pos, err := strconv.Atoi(fields[1])
-			if err != nil {
-				return []CharacterStruct{}, err
-			}
-			length, err := strconv.Atoi(fields[2])
-			if err != nil {
-				return []CharacterStruct{}, err
-			}
-			csa = append(csa, CharacterStruct{V: variant{vtype: "del", vpos: pos, vlength: length}})
-		default:
-			return []CharacterStruct{}, errors.New("could not parse config line (couldn't determine what sort of variant this is): " + line)
 		}
-	}
-
-	err = s.Err()
-	if err != nil {
-		return make([]CharacterStruct, 0), err
+	case "del", "mnv", "ins":
+		if len(fields) != 3 {
+			return []CharacterStruct{}, errors.New("could not parse config line (wrong number of fields): " + line)
+		}
+		pos, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return []CharacterStruct{}, err
+		}
+		length, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return []CharacterStruct{}, err
+		}
+		csa = append(csa, CharacterStruct{V: variant{vtype: fields[0], vpos: pos, vlength: length}})
+	default:
+		return []CharacterStruct{}, errors.New("could not parse config line (couldn't determine what sort of variant this is): " + line)
 	}
 
 	return csa, nil
 }
 
-// like readConfig() but with no amino acid positions
-func readConfigNoAA(configFile string) ([]CharacterStruct, error) {
+// read a config file of variants to type and take also as input information about the positions
+// of CDSes (which can be nil if there is no annotation), and return an array of variant information
+// structs that will be used to type the alignment
+func readConfig(configFile string, cdspos map[string]cdsInfo) ([]CharacterStruct, error) {
 
 	csa := make([]CharacterStruct, 0)
 
@@ -187,33 +402,16 @@ func readConfigNoAA(configFile string) ([]CharacterStruct, error) {
 
 	s := bufio.NewScanner(f)
 	for s.Scan() {
-		line := s.Text()
-		fields := strings.Split(line, ":")
-
-		if len(fields) < 2 {
-			return []CharacterStruct{}, errors.New("could not parse config line (too few fields): " + line)
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 {
+			continue
 		}
 
-		switch fields[0] {
-		case "nuc":
-			pos, err := strconv.Atoi(fields[1])
-			if err != nil {
-				return []CharacterStruct{}, err
-			}
-			csa = append(csa, CharacterStruct{V: variant{vtype: "nuc", vpos: pos}})
-		case "del":
-			pos, err := strconv.Atoi(fields[1])
-			if err != nil {
-				return []CharacterStruct{}, err
-			}
-			length, err := strconv.Atoi(fields[2])
-			if err != nil {
-				return []CharacterStruct{}, err
-			}
-			csa = append(csa, CharacterStruct{V: variant{vtype: "nuc", vpos: pos, vlength: length}})
-		default:
-			return []CharacterStruct{}, errors.New("could not parse config line (couldn't determine what sort of variant this is): " + line)
+		cs, err := parseConfigLine(line, cdspos)
+		if err != nil {
+			return []CharacterStruct{}, err
 		}
+		csa = append(csa, cs...)
 	}
 
 	err = s.Err()
@@ -242,8 +440,12 @@ func getVariantName(v variant) (string, error) {
 		s = v.vtype + ":" + v.vgene + ":" + strconv.Itoa(v.vres)
 	case "nuc":
 		s = v.vtype + ":" + strconv.Itoa(v.vpos)
-	case "del":
+	case "del", "mnv", "ins":
 		s = v.vtype + ":" + strconv.Itoa(v.vpos) + ":" + strconv.Itoa(v.vlength)
+	case "aadel":
+		s = v.vtype + ":" + v.vgene + ":" + strconv.Itoa(v.vres) + ":" + strconv.Itoa(v.vlength/3)
+	case "nucallele", "aaallele", "delallele":
+		s = v.vmut
 	default:
 		return "", errors.New("unknown variant type")
 	}
@@ -298,233 +500,295 @@ func stringInArray(s string, sa []string) bool {
 	return false
 }
 
-// First pass over the alignment to get the number of states for each character.
-// With this information, we will be able to type it in a more memory efficient way - and hopefully straight to the tips
-func countVariantsFastaInner(variantsIn []CharacterStruct, cFR chan fastaio.FastaRecord, cVOut chan []CharacterStruct, cErr chan error) {
+type StartStop struct {
+	Start int
+	Stop  int
+}
 
-	var ok bool
-	var err error
-	var newvar string
-	var rawnuc byte
-	var nucs []string
-	codonMap := MakeCodonDict()
-	nucArr := makeNucLookupArray()
+// get the index of where individual characters are going to occur in the slice of bytes
+func getIndex(csa []CharacterStruct) ([]StartStop, int) {
 
-	// Make the data structures for keeping information about the characters
-	variantsOut := make([]CharacterStruct, len(variantsIn))
+	// make an array of where each character starts and stops in the byte array
+	idx := make([]StartStop, len(csa))
 
-	// What are the characters called
-	for i := range variantsOut {
-		variantsOut[i].V = variantsIn[i].V
-		variantsOut[i].Name, err = getVariantName(variantsOut[i].V)
-		if err != nil {
-			cErr <- err
-		}
+	var start int = 0
+	for i, cs := range csa {
+		length := (len(cs.StateKey) / 8) + 1 // how many bytes are needed to store this character
+		idx[i] = StartStop{Start: start, Stop: start + length}
+		start = start + length
 	}
 
-	// StateKey might be ["A", "C", "G", "T"] (if all four nucs are present at this site in the alignment)
-	for i := range variantsOut {
-		variantsOut[i].StateKey = make([]string, 0)
-	}
+	return idx, start
+}
 
-	for record := range cFR {
-		for i, CS := range variantsIn {
-			switch CS.V.vtype {
-			case "aa":
-				newvar, ok = codonMap[record.Seq[CS.V.vpos-1:CS.V.vpos+2]]
-				if ok {
-					if stringInArray(newvar, variantsOut[i].StateKey) {
-						continue
-					} else {
-						variantsOut[i].StateKey = append(variantsOut[i].StateKey, newvar)
-					}
-				} else {
-					// TO DO: error check the amino acids here
-					continue
-				}
-			case "nuc":
-				rawnuc = []byte{record.Seq[CS.V.vpos-1]}[0]
-				nucs = nucArr[rawnuc]
-				if len(nucs) > 0 {
-					for _, nuc := range nucs {
-						if stringInArray(nuc, variantsOut[i].StateKey) {
-							continue
-						} else {
-							variantsOut[i].StateKey = append(variantsOut[i].StateKey, nuc)
-						}
-					}
-				} else {
-					// TO DO: error check the nucleotides here
-					continue
-				}
-			case "del":
-				newvar = record.Seq[CS.V.vpos-1 : CS.V.vpos-1+CS.V.vlength]
-				switch newvar {
-				case makeDeletion(CS.V.vlength):
-					if stringInArray("del", variantsOut[i].StateKey) {
-						continue
-					} else {
-						variantsOut[i].StateKey = append(variantsOut[i].StateKey, "del")
-					}
-				default:
-					if stringInArray("oth", variantsOut[i].StateKey) {
-						continue
-					} else {
-						variantsOut[i].StateKey = append(variantsOut[i].StateKey, "oth")
-					}
-				}
-			}
+// the fixed state key for nucleotide characters when we type every site in an alignment
+var nucStateKey = []string{"A", "C", "G", "T"}
+
+// make a lookup table from a (IUPAC) nucleotide to its bit-encoded state under nucStateKey
+func makeNucByteLookup() []byte {
+
+	nucArr := makeNucLookupArray()
+	lookup := make([]byte, 256)
+
+	for i := range nucArr {
+		for _, nuc := range nucArr[i] {
+			bitToSet, _ := stringIndexInArray(nuc, nucStateKey)
+			bitsets.SetBit(lookup[i:i+1], bitToSet)
 		}
 	}
 
-	cVOut <- variantsOut
+	return lookup
 }
 
-func countVariantsFasta(alignmentFile string, variants []CharacterStruct) ([]CharacterStruct, error) {
-
-	cFR := make(chan fastaio.FastaRecord)
-	cErr := make(chan error)
-	cFRDone := make(chan bool)
-
-	cCS := make(chan []CharacterStruct)
+// convert the state(s) a sequence has at a site into whether a derived allele is present or absent.
+// An ambiguous site can be both
+func alleleStates(observed []string, derived string) []string {
+	states := make([]string, 0)
+	for _, o := range observed {
+		switch {
+		case o == derived && !stringInArray("present", states):
+			states = append(states, "present")
+		case o != derived && !stringInArray("absent", states):
+			states = append(states, "absent")
+		}
+	}
+	return states
+}
 
-	go fastaio.ReadAlignment(alignmentFile, cFR, cErr, cFRDone)
+// get the codon of an amino acid character from a sequence, from its three sites in reading order,
+// complementing it if it is on the minus strand
+func variantCodon(seq string, v variant) string {
+	codon := string([]byte{seq[v.vcodon[0]-1], seq[v.vcodon[1]-1], seq[v.vcodon[2]-1]})
+	if v.vcomp {
+		return annotation.Complement(codon)
+	}
+	return codon
+}
 
-	go countVariantsFastaInner(variants, cFR, cCS, cErr)
+// get the state(s) that one sequence has at one character. An empty slice means the data are missing
+func getVariantStates(seq string, CS CharacterStruct, codonMap map[string]string, nucArr [][]string) ([]string, error) {
 
-	for n := 1; n > 0; {
-		select {
-		case err := <-cErr:
-			return []CharacterStruct{}, err
-		case <-cFRDone:
-			close(cFR)
-			n--
-		}
+	var width int
+	switch CS.V.vtype {
+	case "aa", "aaallele":
+		// the codon can span an intron, so this is from its lowest site to its highest
+		width = highestSite(CS.V.vcodon) - CS.V.vpos + 1
+	case "nuc", "nucallele":
+		width = 1
+	default:
+		width = CS.V.vlength
 	}
 
-	CSA := make([]CharacterStruct, 0)
+	if CS.V.vpos < 1 || CS.V.vpos-1+width > len(seq) {
+		return []string{}, errors.New("character is out of range of the alignment: " + CS.Name)
+	}
 
-	for n := 1; n > 0; {
-		select {
-		case err := <-cErr:
-			return []CharacterStruct{}, err
-		case temp := <-cCS:
-			CSA = temp
-			n--
+	switch CS.V.vtype {
+	case "aa":
+		// ambiguous codons are typed as the set of amino acids they could code for
+		return translateCodon(variantCodon(seq, CS.V), codonMap, nucArr), nil
+	case "nuc":
+		// TO DO: error check the nucleotides here
+		return nucArr[seq[CS.V.vpos-1]], nil
+	case "del", "aadel":
+		if seq[CS.V.vpos-1:CS.V.vpos-1+CS.V.vlength] == makeDeletion(CS.V.vlength) {
+			return []string{"del"}, nil
+		}
+		return []string{"oth"}, nil
+	case "mnv":
+		// the haplotype is only typed if every site in it is a nucleotide or a gap
+		haplotype := seq[CS.V.vpos-1 : CS.V.vpos-1+CS.V.vlength]
+		for i := 0; i < len(haplotype); i++ {
+			if !strings.ContainsRune("ACGT-", rune(haplotype[i])) {
+				return []string{}, nil
+			}
 		}
+		return []string{haplotype}, nil
+	case "ins":
+		// insertion columns are gaps in the reference, so a sequence either has nothing
+		// here, or it has an insertion, which we type as the inserted bases
+		columns := seq[CS.V.vpos-1 : CS.V.vpos-1+CS.V.vlength]
+		if columns == makeDeletion(CS.V.vlength) {
+			return []string{"none"}, nil
+		}
+		for i := 0; i < len(columns); i++ {
+			if !strings.ContainsRune("ACGT-", rune(columns[i])) {
+				return []string{}, nil
+			}
+		}
+		return []string{strings.ReplaceAll(columns, "-", "")}, nil
+	case "nucallele":
+		return alleleStates(nucArr[seq[CS.V.vpos-1]], CS.V.valt), nil
+	case "aaallele":
+		return alleleStates(translateCodon(variantCodon(seq, CS.V), codonMap, nucArr), CS.V.valt), nil
+	case "delallele":
+		columns := seq[CS.V.vpos-1 : CS.V.vpos-1+CS.V.vlength]
+		if columns == makeDeletion(CS.V.vlength) {
+			return []string{"present"}, nil
+		}
+		if strings.ContainsRune(columns, 'N') {
+			return []string{}, nil
+		}
+		return []string{"absent"}, nil
 	}
 
-	return CSA, nil
+	return []string{}, errors.New("unknown variant type")
 }
 
-type StartStop struct {
-	Start int
-	Stop  int
+// typedRecord is one alignment record typed at every character. Because we only read the alignment
+// once, we don't know all the states of each character until the end, so the bits in States refer to
+// the state keys that the worker which typed this record has seen so far, and get remapped later
+type typedRecord struct {
+	ID     string
+	worker int
+	States [][]byte // one growable bitset per character
 }
 
-// get the index of where individual characters are going to occur in the slice of bytes
-func getIndex(csa []CharacterStruct) ([]StartStop, int) {
-
-	// make an array of where each character starts and stops in the byte array
-	idx := make([]StartStop, len(csa))
+// the state keys that one typing worker has seen for each character
+type workerKeys struct {
+	worker int
+	keys   [][]string
+}
 
-	var start int = 0
-	for i, cs := range csa {
-		length := (len(cs.StateKey) / 8) + 1 // how many bytes are needed to store this character
-		idx[i] = StartStop{Start: start, Stop: start + length}
-		start = start + length
+// set the (1-based) kth bit in a bitset, growing it first if it is too small
+func setBitGrow(ba []byte, k int) []byte {
+	for len(ba)*8 < k {
+		ba = append(ba, 0)
 	}
-
-	return idx, start
+	bitsets.SetBit(ba, k)
+	return ba
 }
 
-// Spin up a few instances of this:
-func typeVariants(idx []StartStop, l int, variantsIn []CharacterStruct, cFR chan fastaio.FastaRecord, cNS chan NodeStates, cErr chan error) {
+// Spin up a few instances of this. Each one types the records it receives at every character, adding any new states
+// it sees to its own state keys, which it sends down cWK once there are no more records. If coords isn't nil, the
+// records are typed in reference coordinates (apart from insertions, which are typed from the alignment columns)
+func typeVariants(worker int, variantsIn []CharacterStruct, coords *RefCoords, cFR chan annotation.FastaRecord, cTR chan typedRecord, cWK chan workerKeys, cErr chan error) {
 
-	var ok bool
-	var err error
-	var newvar string
-	var rawnuc byte
-	var nucs []string
 	var bitToSet int
-	var start, stop int
-	codonMap := MakeCodonDict()
 	nucArr := makeNucLookupArray()
 
+	// the genetic codes of the amino acid characters (CDSs can have different ones)
+	codonMaps := make(map[int]map[string]string)
+	for _, CS := range variantsIn {
+		if _, ok := codonMaps[CS.V.vtable]; !ok && CS.V.vtable > 0 {
+			codonMaps[CS.V.vtable], _ = annotation.GeneticCode(CS.V.vtable)
+		}
+	}
+
+	keys := make([][]string, len(variantsIn))
+	for i := range keys {
+		keys[i] = make([]string, 0)
+	}
+
 	for record := range cFR {
 
-		NS := NodeStates{}
-		NS.ID = record.ID
-		NS.States = make([]byte, l, l)
+		TR := typedRecord{ID: record.ID, worker: worker, States: make([][]byte, len(variantsIn))}
+
+		refseq := record.Seq
+		if coords != nil {
+			var err error
+			refseq, err = coords.project(record.Seq)
+			if err != nil {
+				cErr <- errors.New(err.Error() + ": " + record.ID)
+				return
+			}
+		}
 
 		for i, CS := range variantsIn {
+			seq := refseq
+			if CS.V.vtype == "ins" {
+				seq = record.Seq
+			}
+			newvars, err := getVariantStates(seq, CS, codonMaps[CS.V.vtable], nucArr)
+			if err != nil {
+				cErr <- err
+				return
+			}
+			// If there is missing data, we don't set any bits
+			for _, newvar := range newvars {
+				if !stringInArray(newvar, keys[i]) {
+					keys[i] = append(keys[i], newvar)
+				}
+				bitToSet, _ = stringIndexInArray(newvar, keys[i])
+				TR.States[i] = setBitGrow(TR.States[i], bitToSet)
+			}
+		}
 
-			start = idx[i].Start
-			stop = idx[i].Stop
+		cTR <- TR
+	}
 
-			switch CS.V.vtype {
-			case "aa":
-				newvar, ok = codonMap[record.Seq[CS.V.vpos-1:CS.V.vpos+2]]
-				if ok {
-					bitToSet, err = stringIndexInArray(newvar, CS.StateKey)
-					if err != nil {
-						cErr <- err
-					}
-					bitsets.SetBit(NS.States[start:stop], bitToSet)
-				} else {
-					// If there is missing data, we don't set any bits?
-					continue
-				}
-			case "nuc":
-				rawnuc = []byte{record.Seq[CS.V.vpos-1]}[0]
-				nucs = nucArr[rawnuc]
-				if len(nucs) > 0 {
-					for _, nuc := range nucs {
-						bitToSet, err = stringIndexInArray(nuc, CS.StateKey)
-						if err != nil {
-							cErr <- err
-						}
-						bitsets.SetBit(NS.States[start:stop], bitToSet)
-					}
-				} else {
-					// If there is missing data, we don't set any bits?
-					continue
-				}
-			case "del":
-				newvar = record.Seq[CS.V.vpos-1 : CS.V.vpos-1+CS.V.vlength]
-				switch newvar {
-				case makeDeletion(CS.V.vlength):
-					bitToSet, err = stringIndexInArray("del", CS.StateKey)
-					if err != nil {
-						cErr <- err
-					}
-					bitsets.SetBit(NS.States[start:stop], bitToSet)
-				default:
-					bitToSet, err = stringIndexInArray("oth", CS.StateKey)
-					if err != nil {
-						cErr <- err
-					}
-					bitsets.SetBit(NS.States[start:stop], bitToSet)
+	cWK <- workerKeys{worker: worker, keys: keys}
+}
+
+// merge the state keys from all the typing workers into one (sorted) state key per character, and return
+// a map from each worker's (1-based) bits to the bits in the merged keys, indexed as [worker][character][bit-1]
+func mergeStateKeys(variants []CharacterStruct, wka []workerKeys) ([]CharacterStruct, [][][]int) {
+
+	characterStates := make([]CharacterStruct, len(variants))
+	for i := range characterStates {
+		characterStates[i].Name = variants[i].Name
+		characterStates[i].V = variants[i].V
+		characterStates[i].StateKey = make([]string, 0)
+		for _, wk := range wka {
+			for _, state := range wk.keys[i] {
+				if !stringInArray(state, characterStates[i].StateKey) {
+					characterStates[i].StateKey = append(characterStates[i].StateKey, state)
 				}
 			}
 		}
+		sort.Strings(characterStates[i].StateKey)
+	}
 
-		cNS <- NS
+	remap := make([][][]int, len(wka))
+	for _, wk := range wka {
+		remap[wk.worker] = make([][]int, len(variants))
+		for i := range variants {
+			remap[wk.worker][i] = make([]int, len(wk.keys[i]))
+			for j, state := range wk.keys[i] {
+				remap[wk.worker][i][j], _ = stringIndexInArray(state, characterStates[i].StateKey)
+			}
+		}
 	}
-	return
+
+	return characterStates, remap
 }
 
-func assignNodeStatesToStatesArray(t *tree.Tree, l int, cNS chan NodeStates, cErr chan error, cResults chan [][]byte) {
+func collectTypedRecords(cTR chan typedRecord, cResults chan []typedRecord) {
+	tra := make([]typedRecord, 0)
+	for tr := range cTR {
+		tra = append(tra, tr)
+	}
+	cResults <- tra
+}
 
-	states := make([][]byte, len(t.Nodes()), len(t.Nodes()))
-	for i := range states {
-		states[i] = make([]byte, l, l)
+// is this record the reference row of a gapped-reference alignment, which doesn't need to be in the tree?
+func isUntypedReference(t *tree.Tree, ID string, coords *RefCoords) bool {
+	if coords == nil || ID != coords.RefID {
+		return false
 	}
+	_, err := t.TipId(ID)
+	return err != nil
+}
+
+func assignNodeStatesToStatesArray(t *tree.Tree, coords *RefCoords, cNS chan NodeStates, cErr chan error, cResults chan [][]byte) {
+
+	states := make([][]byte, len(t.Nodes()), len(t.Nodes()))
 
+	l := -1
 	for ns := range cNS {
+		if l == -1 {
+			l = len(ns.States)
+		} else if len(ns.States) != l {
+			cErr <- errors.New("sequences in the alignment are not all the same length: " + ns.ID)
+			return
+		}
+		if isUntypedReference(t, ns.ID, coords) {
+			continue
+		}
 		id, err := t.TipId(ns.ID)
 		if err != nil {
 			cErr <- err
+			return
 		}
 		states[id] = ns.States
 	}
@@ -532,59 +796,82 @@ func assignNodeStatesToStatesArray(t *tree.Tree, l int, cNS chan NodeStates, cEr
 	cResults <- states
 }
 
+// any node that hasn't been given any states yet (internal nodes, and tips that weren't typed) gets an empty
+// bitset of length l
+func fillEmptyStates(states [][]byte, l int) {
+	for i := range states {
+		if states[i] == nil {
+			states[i] = make([]byte, l, l)
+		}
+	}
+}
+
 // for every record in an alignment, type it at each variant in a variant config file, and return
-// the information in map from tip name -> array of bit-encoded character states
-func TypeAlignment(t *tree.Tree, alignmentFile string, configFile string, genbankFile string) ([]CharacterStruct, []StartStop, [][]byte, error) {
+// the information in map from tip name -> array of bit-encoded character states.
+// The alignment is only read once: the state keys are built up as we go, then the typed records
+// are remapped onto the final state keys at the end.
+// If coords isn't nil, the positions in the config file are reference coordinates.
+// The annotation can be a genbank file, or a GFF3 file (with its sequence in fastaFile if it has no ##FASTA section)
+func TypeAlignment(t *tree.Tree, alignmentFile string, configFile string, genbankFile string, fastaFile string, geneticCode int, naming annotation.CDSNaming, coords *RefCoords) ([]CharacterStruct, []StartStop, [][]byte, error) {
 
 	var err error
 	var gb genbank.Genbank
-	var cdspos map[string]string
+	var cdspos map[string]cdsInfo
 	var config []CharacterStruct
 
 	if len(genbankFile) > 0 {
-		gb, err = genbank.ReadGenBank(genbankFile)
+		gb, err = annotation.ReadAnnotation(genbankFile, fastaFile)
+		if err != nil {
+			return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
+		}
+		cdspos, err = getCDSPosFromAnnotation(gb, geneticCode, naming)
 		if err != nil {
 			return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
 		}
-		cdspos = getCDSPosFromAnnotation(gb)
 
 		config, err = readConfig(configFile, cdspos)
 		if err != nil {
 			return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
 		}
 	} else {
-		config, err = readConfigNoAA(configFile)
+		config, err = readConfig(configFile, nil)
 		if err != nil {
 			return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
 		}
 	}
 
-	characterStates, err := countVariantsFasta(alignmentFile, config)
-	if err != nil {
-		return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
+	// What are the characters called
+	for i := range config {
+		config[i].Name, err = getVariantName(config[i].V)
+		if err != nil {
+			return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
+		}
+		if coords != nil && config[i].V.vtype == "ins" {
+			config[i].V.vpos, err = coords.insertionColumn(config[i].V)
+			if err != nil {
+				return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
+			}
+		}
 	}
 
-	// the array of start/stop positions and the total length of the byte slice of characters
-	// idx is []StartStop, length is int
-	idx, length := getIndex(characterStates)
-
 	cErr := make(chan error)
-	cFR := make(chan fastaio.FastaRecord)
+	cFR := make(chan annotation.FastaRecord)
 	cFRDone := make(chan bool)
 	cTypeVariantsDone := make(chan bool)
-	cNS := make(chan NodeStates)
-	cNSResults := make(chan [][]byte)
+	cTR := make(chan typedRecord)
+	cWK := make(chan workerKeys, runtime.NumCPU())
+	cTRResults := make(chan []typedRecord)
 
 	var wgTypeVariants sync.WaitGroup
 	wgTypeVariants.Add(runtime.NumCPU())
 
-	go fastaio.ReadAlignment(alignmentFile, cFR, cErr, cFRDone)
+	go annotation.StreamFasta(alignmentFile, cFR, cErr, cFRDone)
 
 	for n := 0; n < runtime.NumCPU(); n++ {
-		go func() {
-			typeVariants(idx, length, characterStates, cFR, cNS, cErr)
+		go func(worker int) {
+			typeVariants(worker, config, coords, cFR, cTR, cWK, cErr)
 			wgTypeVariants.Done()
-		}()
+		}(n)
 	}
 
 	go func() {
@@ -592,7 +879,7 @@ func TypeAlignment(t *tree.Tree, alignmentFile string, configFile string, genban
 		cTypeVariantsDone <- true
 	}()
 
-	go assignNodeStatesToStatesArray(t, length, cNS, cErr, cNSResults)
+	go collectTypedRecords(cTR, cTRResults)
 
 	for n := 1; n > 0; {
 		select {
@@ -609,106 +896,93 @@ func TypeAlignment(t *tree.Tree, alignmentFile string, configFile string, genban
 		case err := <-cErr:
 			return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
 		case <-cTypeVariantsDone:
-			close(cNS)
-			n--
-		}
-	}
-
-	var states [][]byte
-	for n := 1; n > 0; {
-		select {
-		case err := <-cErr:
-			return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
-		case states = <-cNSResults:
+			close(cTR)
+			close(cWK)
 			n--
 		}
 	}
 
-	return characterStates, idx, states, nil
-}
-
-func getAlignmentDims(infile string) (int, int, error) {
-	n := 0
-	l := 0
+	typedRecords := <-cTRResults
 
-	f, err := os.Open(infile)
-	if err != nil {
-		return 0, 0, err
+	wka := make([]workerKeys, 0)
+	for wk := range cWK {
+		wka = append(wka, wk)
 	}
-	defer f.Close()
 
-	s := bufio.NewScanner(f)
+	characterStates, remap := mergeStateKeys(config, wka)
 
-	for s.Scan() {
-		line := s.Text()
+	// the array of start/stop positions and the total length of the byte slice of characters
+	// idx is []StartStop, length is int
+	idx, length := getIndex(characterStates)
 
-		if string(line[0]) == ">" {
-			n++
-		}
+	states := make([][]byte, len(t.Nodes()), len(t.Nodes()))
 
-		if n == 1 && string(line[0]) != ">" {
-			l += len(line)
+	for _, tr := range typedRecords {
+		if isUntypedReference(t, tr.ID, coords) {
+			continue
+		}
+		id, err := t.TipId(tr.ID)
+		if err != nil {
+			return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
+		}
+		states[id] = make([]byte, length, length)
+		for i := range tr.States {
+			for _, b := range bitsets.GetSetBits(tr.States[i]) {
+				bitsets.SetBit(states[id][idx[i].Start:idx[i].Stop], remap[tr.worker][i][b-1])
+			}
 		}
 	}
 
-	err = s.Err()
-
-	if err != nil {
-		return 0, 0, err
-	}
+	fillEmptyStates(states, length)
 
-	return n, l, err
+	return characterStates, idx, states, nil
 }
 
-// for every record in an alignment, type it at each nucleotide
-func TypeAlignmentNuc(t *tree.Tree, alignmentFile string) ([]CharacterStruct, []StartStop, [][]byte, error) {
-
-	var err error
-	config := make([]CharacterStruct, 0)
-
-	_, l, err := getAlignmentDims(alignmentFile)
-	if err != nil {
-		return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
+// Spin up a few instances of this. Each one types every site of the records it receives against the fixed
+// nucleotide state key, so that every character takes up exactly one byte
+func typeNucs(lookup []byte, cFR chan annotation.FastaRecord, cNS chan NodeStates) {
+	for record := range cFR {
+		NS := NodeStates{ID: record.ID, States: make([]byte, len(record.Seq))}
+		for i := 0; i < len(record.Seq); i++ {
+			NS.States[i] = lookup[record.Seq[i]]
+		}
+		cNS <- NS
 	}
+}
 
-	for i := 0; i < l; i++ {
-		config = append(config, CharacterStruct{V: variant{vtype: "nuc", vpos: i + 1}})
-	}
+// for every record in an alignment, type it at each nucleotide. The alignment is only read once,
+// and every site uses the fixed A/C/G/T state key.
+// If coords isn't nil, the characters are the reference positions (the insertion columns are
+// dropped, and recorded in coords.Insertions)
+func TypeAlignmentNuc(t *tree.Tree, alignmentFile string, coords *RefCoords) ([]CharacterStruct, []StartStop, [][]byte, error) {
 
-	characterStates, err := countVariantsFasta(alignmentFile, config)
-	if err != nil {
-		return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
-	}
-
-	// the array of start/stop positions and the total length of the byte slice of characters
-	// idx is []StartStop, length is int
-	idx, length := getIndex(characterStates)
+	lookup := makeNucByteLookup()
 
 	cErr := make(chan error)
-	cFR := make(chan fastaio.FastaRecord)
+	cFR := make(chan annotation.FastaRecord)
 	cFRDone := make(chan bool)
-	cTypeVariantsDone := make(chan bool)
+	cTypeNucsDone := make(chan bool)
 	cNS := make(chan NodeStates)
 	cNSResults := make(chan [][]byte)
 
-	var wgTypeVariants sync.WaitGroup
-	wgTypeVariants.Add(runtime.NumCPU())
+	var wgTypeNucs sync.WaitGroup
+	wgTypeNucs.Add(runtime.NumCPU())
 
-	go fastaio.ReadAlignment(alignmentFile, cFR, cErr, cFRDone)
+	go annotation.StreamFasta(alignmentFile, cFR, cErr, cFRDone)
 
 	for n := 0; n < runtime.NumCPU(); n++ {
 		go func() {
-			typeVariants(idx, length, characterStates, cFR, cNS, cErr)
-			wgTypeVariants.Done()
+			typeNucs(lookup, cFR, cNS)
+			wgTypeNucs.Done()
 		}()
 	}
 
 	go func() {
-		wgTypeVariants.Wait()
-		cTypeVariantsDone <- true
+		wgTypeNucs.Wait()
+		cTypeNucsDone <- true
 	}()
 
-	go assignNodeStatesToStatesArray(t, length, cNS, cErr, cNSResults)
+	go assignNodeStatesToStatesArray(t, coords, cNS, cErr, cNSResults)
 
 	for n := 1; n > 0; {
 		select {
@@ -724,7 +998,7 @@ func TypeAlignmentNuc(t *tree.Tree, alignmentFile string) ([]CharacterStruct, []
 		select {
 		case err := <-cErr:
 			return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
-		case <-cTypeVariantsDone:
+		case <-cTypeNucsDone:
 			close(cNS)
 			n--
 		}
@@ -740,5 +1014,34 @@ func TypeAlignmentNuc(t *tree.Tree, alignmentFile string) ([]CharacterStruct, []
 		}
 	}
 
+	// the alignment length is the length of any sequence that we typed
+	l := 0
+	for i := range states {
+		if states[i] != nil {
+			l = len(states[i])
+			break
+		}
+	}
+
+	if coords != nil {
+		var err error
+		states, err = coords.projectStates(states)
+		if err != nil {
+			return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
+		}
+		l = coords.refLength()
+	}
+
+	fillEmptyStates(states, l)
+
+	characterStates := make([]CharacterStruct, l)
+	for i := range characterStates {
+		characterStates[i].V = variant{vtype: "nuc", vpos: i + 1}
+		characterStates[i].Name, _ = getVariantName(characterStates[i].V)
+		characterStates[i].StateKey = nucStateKey
+	}
+
+	idx, _ := getIndex(characterStates)
+
 	return characterStates, idx, states, nil
 }
@@ -0,0 +1,375 @@
+package characterio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/ash/pkg/bitsets"
+	"github.com/benjamincjackson/gotree/newick"
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+// the tree of the tips in testdata/typing.fasta
+func typingTree(t *testing.T) *tree.Tree {
+	tr, err := newick.NewParser(strings.NewReader("((a,b),(c,d));")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.UpdateTipIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+// type testdata/typing.fasta with a variants config of the given lines, and get the names of the states that each tip
+// has at each character. A character with no states is missing data
+func typeConfig(t *testing.T, lines ...string) (map[string]map[string][]string, error) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(configFile, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := typingTree(t)
+	characters, idx, states, err := TypeAlignment(tr, "testdata/typing.fasta", configFile, "testdata/typing.gb", "", 1, annotation.DefaultCDSNaming, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := make(map[string]map[string][]string)
+	for _, tip := range tr.Tips() {
+		typed[tip.Name()] = make(map[string][]string)
+		for i, c := range characters {
+			names := make([]string, 0)
+			for _, bit := range bitsets.GetSetBits(states[tip.Id()][idx[i].Start:idx[i].Stop]) {
+				names = append(names, c.StateKey[bit-1])
+			}
+			typed[tip.Name()][c.Name] = names
+		}
+	}
+	return typed, nil
+}
+
+func Test_TypeAlignment(t *testing.T) {
+	tests := []struct {
+		lines         []string
+		desiredResult map[string]map[string][]string
+	}{
+		// c has a gap, and d an R (A or G)
+		{[]string{"nuc:6"}, map[string]map[string][]string{
+			"a": {"nuc:6": {"A"}},
+			"b": {"nuc:6": {"G"}},
+			"c": {"nuc:6": {}},
+			"d": {"nuc:6": {"A", "G"}},
+		}},
+		{[]string{"nuc:1", "del:4:3"}, map[string]map[string][]string{
+			"a": {"nuc:1": {"A"}, "del:4:3": {"oth"}},
+			"b": {"nuc:1": {"A"}, "del:4:3": {"oth"}},
+			"c": {"nuc:1": {"A"}, "del:4:3": {"del"}},
+			"d": {"nuc:1": {}, "del:4:3": {"oth"}},
+		}},
+		// a range of sites, every residue of a gene, a haplotype, a deletion of whole codons and an insertion
+		{[]string{"nuc:4-5", "aa:G1:*"}, map[string]map[string][]string{
+			"a": {"nuc:4": {"G"}, "nuc:5": {"A"}, "aa:g1:1": {"M"}, "aa:g1:2": {"E"}, "aa:g1:3": {"R"}, "aa:g1:4": {"*"}},
+			"b": {"nuc:4": {"G"}, "nuc:5": {"A"}, "aa:g1:1": {"M"}, "aa:g1:2": {"E"}, "aa:g1:3": {"R"}, "aa:g1:4": {"*"}},
+			"c": {"nuc:4": {}, "nuc:5": {}, "aa:g1:1": {"M"}, "aa:g1:2": {}, "aa:g1:3": {"R"}, "aa:g1:4": {"*"}},
+			"d": {"nuc:4": {"G"}, "nuc:5": {"A"}, "aa:g1:1": {}, "aa:g1:2": {"E"}, "aa:g1:3": {"R"}, "aa:g1:4": {"*"}},
+		}},
+		{[]string{"mnv:4:3", "aadel:G1:2:1", "ins:13:3"}, map[string]map[string][]string{
+			"a": {"mnv:4:3": {"GAA"}, "aadel:g1:2:1": {"oth"}, "ins:13:3": {"none"}},
+			"b": {"mnv:4:3": {"GAG"}, "aadel:g1:2:1": {"oth"}, "ins:13:3": {"CCA"}},
+			"c": {"mnv:4:3": {"---"}, "aadel:g1:2:1": {"del"}, "ins:13:3": {"none"}},
+			"d": {"mnv:4:3": {}, "aadel:g1:2:1": {"oth"}, "ins:13:3": {"none"}},
+		}},
+		// named mutations are binary characters named by the mutation. d's R (A or G) could be either, and its N is
+		// missing data, in a codon as at a nucleotide site
+		{[]string{"nuc:A6G", "G1:M1L", "G1:del2-2"}, map[string]map[string][]string{
+			"a": {"nuc:A6G": {"absent"}, "G1:M1L": {"absent"}, "G1:del2-2": {"absent"}},
+			"b": {"nuc:A6G": {"present"}, "G1:M1L": {"absent"}, "G1:del2-2": {"absent"}},
+			"c": {"nuc:A6G": {}, "G1:M1L": {"absent"}, "G1:del2-2": {"present"}},
+			"d": {"nuc:A6G": {"absent", "present"}, "G1:M1L": {}, "G1:del2-2": {"absent"}},
+		}},
+		// G2 is on the minus strand: c's T23C makes its second codon AGA (R), and d's Y there makes it AAA or AGA
+		{[]string{"aa:G2:*", "G2:K2R"}, map[string]map[string][]string{
+			"a": {"aa:g2:1": {"M"}, "aa:g2:2": {"K"}, "aa:g2:3": {"F"}, "aa:g2:4": {"*"}, "G2:K2R": {"absent"}},
+			"b": {"aa:g2:1": {"M"}, "aa:g2:2": {"K"}, "aa:g2:3": {"F"}, "aa:g2:4": {"*"}, "G2:K2R": {"absent"}},
+			"c": {"aa:g2:1": {"M"}, "aa:g2:2": {"R"}, "aa:g2:3": {"F"}, "aa:g2:4": {"*"}, "G2:K2R": {"present"}},
+			"d": {"aa:g2:1": {"M"}, "aa:g2:2": {"K", "R"}, "aa:g2:3": {"F"}, "aa:g2:4": {"*"}, "G2:K2R": {"absent", "present"}},
+		}},
+	}
+
+	for _, test := range tests {
+		typed, err := typeConfig(t, test.lines...)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(typed, test.desiredResult) {
+			t.Errorf("error in Test_TypeAlignment")
+		}
+	}
+}
+
+func Test_TypeAlignmentNuc(t *testing.T) {
+	tr := typingTree(t)
+	characters, idx, states, err := TypeAlignmentNuc(tr, "testdata/typing.fasta", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(characters) != 30 || len(idx) != 30 || !reflect.DeepEqual(characters[5].StateKey, []string{"A", "C", "G", "T"}) {
+		t.Errorf("error in Test_TypeAlignmentNuc")
+	}
+
+	// every site is one byte, with the bits in A, C, G, T order. N and gaps are missing data (no bits)
+	tests := []struct {
+		tip           string
+		desiredResult []byte
+	}{
+		{"a", []byte{128, 16, 32, 32, 128, 128}},
+		{"b", []byte{128, 16, 32, 32, 128, 32}},
+		{"c", []byte{128, 16, 32, 0, 0, 0}},
+		{"d", []byte{0, 16, 32, 32, 128, 160}},
+	}
+
+	for _, test := range tests {
+		id, err := tr.TipId(test.tip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(states[id][:6], test.desiredResult) {
+			t.Errorf("error in Test_TypeAlignmentNuc")
+		}
+	}
+}
+
+func Test_getCDSPosFromAnnotation(t *testing.T) {
+	gb, err := annotation.ReadAnnotation("../annotation/testdata/polyprotein_minus.gb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdspos, err := getCDSPosFromAnnotation(gb, 1, annotation.DefaultCDSNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the mature peptides on the minus strand take their codons from their CDS
+	desiredResult := map[string]cdsInfo{
+		"p":    {codons: [][3]int{{24, 23, 22}, {21, 20, 19}, {18, 17, 16}, {15, 14, 13}, {12, 11, 10}, {9, 8, 7}}, complement: true, table: 1},
+		"nsp1": {codons: [][3]int{{24, 23, 22}, {21, 20, 19}, {18, 17, 16}}, complement: true, table: 1},
+		"nsp2": {codons: [][3]int{{15, 14, 13}, {12, 11, 10}, {9, 8, 7}}, complement: true, table: 1},
+		"q":    {codons: [][3]int{{1, 2, 3}, {4, 5, 6}}, table: 1},
+	}
+	if !reflect.DeepEqual(cdspos, desiredResult) {
+		t.Errorf("error in Test_getCDSPosFromAnnotation")
+	}
+
+	// nsp12 is only in frame in ORF1ab, where site 13468 is read twice by the ribosomal slippage, and nsp11 is only in
+	// frame in ORF1a, which doesn't slip
+	gb, err = annotation.ReadAnnotation("../annotation/testdata/MN908947.3.gb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdspos, err = getCDSPosFromAnnotation(gb, 1, annotation.DefaultCDSNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cdspos["nsp12"].codons) != 932 || cdspos["nsp12"].codons[9] != [3]int{13468, 13469, 13470} {
+		t.Errorf("error in Test_getCDSPosFromAnnotation")
+	}
+	if len(cdspos["nsp11"].codons) != 13 || cdspos["nsp11"].codons[9] != [3]int{13469, 13470, 13471} {
+		t.Errorf("error in Test_getCDSPosFromAnnotation")
+	}
+}
+
+func Test_parseConfigLine(t *testing.T) {
+	gb, err := annotation.ReadAnnotation("testdata/typing.gb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdspos, err := getCDSPosFromAnnotation(gb, 1, annotation.DefaultCDSNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line          string
+		desiredResult []string // the names of the characters, or nil for an error
+	}{
+		{"nuc:7", []string{"nuc:7"}},
+		{"nuc:7-9", []string{"nuc:7", "nuc:8", "nuc:9"}},
+		{"aa:G1:3", []string{"aa:g1:3"}},
+		{"aa:G2:*", []string{"aa:g2:1", "aa:g2:2", "aa:g2:3", "aa:g2:4"}},
+		{"del:4:6", []string{"del:4:6"}},
+		{"aadel:G1:2:2", []string{"aadel:g1:2:2"}},
+		{"mnv:4:3", []string{"mnv:4:3"}},
+		{"ins:13:3", []string{"ins:13:3"}},
+		{"nuc:9-7", nil},
+		{"aa:G3:1", nil},
+		{"mnv:4", nil},
+		{"nuc", nil},
+		{"nuc:", nil},
+		{"S:", nil},
+	}
+
+	for _, test := range tests {
+		characters, err := parseConfigLine(test.line, cdspos)
+		if test.desiredResult == nil {
+			if err == nil {
+				t.Errorf("error in Test_parseConfigLine")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		names := make([]string, 0)
+		for _, c := range characters {
+			name, err := getVariantName(c.V)
+			if err != nil {
+				t.Error(err)
+			}
+			names = append(names, name)
+		}
+		if !reflect.DeepEqual(names, test.desiredResult) {
+			t.Errorf("error in Test_parseConfigLine")
+		}
+	}
+}
+
+func Test_parseMutation(t *testing.T) {
+	tests := []struct {
+		mutation string
+		anc      string
+		pos      int
+		alt      string
+		err      bool
+	}{
+		{"D614G", "D", 614, "G", false},
+		{"C241T", "C", 241, "T", false},
+		{"Q27*", "Q", 27, "*", false},
+		{"DG", "", 0, "", true},
+		{"D6x4G", "", 0, "", true},
+	}
+
+	for _, test := range tests {
+		anc, pos, alt, err := parseMutation(test.mutation)
+		if (err != nil) != test.err || anc != test.anc || pos != test.pos || alt != test.alt {
+			t.Errorf("error in Test_parseMutation")
+		}
+	}
+}
+
+func Test_isMutationNotation(t *testing.T) {
+	tests := []struct {
+		line          string
+		desiredResult bool
+	}{
+		{"S:D614G", true},
+		{"nuc:C241T", true},
+		{"ORF1a:del3675-3677", true},
+		{"nuc:del686-694", true},
+		{"nuc:241", false},
+		{"nuc:241-250", false},
+		{"nuc:", false},
+		{"aa:S:614", false},
+		{"del:686:9", false},
+		{"aadel:S:69:2", false},
+	}
+
+	for _, test := range tests {
+		if isMutationNotation(strings.Split(test.line, ":")) != test.desiredResult {
+			t.Errorf("error in Test_isMutationNotation")
+		}
+	}
+}
+
+func Test_residueCodon(t *testing.T) {
+	tests := []struct {
+		residue  int
+		location string
+		codon    [3]int
+		pos      int // the lowest site of the codon
+		err      bool
+	}{
+		{1, "1..12", [3]int{1, 2, 3}, 1, false},
+		{4, "1..12", [3]int{10, 11, 12}, 10, false},
+		{3, "join(1..6,10..15)", [3]int{10, 11, 12}, 10, false},
+		{1, "complement(16..27)", [3]int{27, 26, 25}, 25, false},
+		{4, "complement(16..27)", [3]int{18, 17, 16}, 16, false},
+		// codons that span an intron, which isn't a whole number of codons
+		{4, "join(1..10,15..40)", [3]int{10, 15, 16}, 10, false},
+		{5, "join(1..10,15..40)", [3]int{17, 18, 19}, 17, false},
+		{4, "complement(join(43..47,50..59))", [3]int{50, 47, 46}, 46, false},
+		{5, "complement(join(43..47,50..59))", [3]int{45, 44, 43}, 43, false},
+		// a spliced CDS on the minus strand is read from its last range, whichever way its location is written
+		{1, "join(complement(10..15),complement(1..6))", [3]int{15, 14, 13}, 13, false},
+		{0, "1..12", [3]int{}, 0, true},
+		{5, "1..12", [3]int{}, 0, true},
+	}
+
+	for _, test := range tests {
+		positions, complement, err := annotation.ParseLocation(test.location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codons, err := annotation.CodonSites(positions, complement)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codon, err := residueCodon(cdsInfo{codons: codons, complement: complement}, test.residue)
+		if (err != nil) != test.err || codon != test.codon || (err == nil && lowestSite(codon) != test.pos) {
+			t.Errorf("error in Test_residueCodon")
+		}
+	}
+}
+
+func Test_TypeAlignmentSpliced(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(configFile, []byte("aa:G1:4\naa:G2:4\nG1:G4E\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := typingTree(t)
+
+	// G1's fourth codon is sites 10, 15 and 16 (GGG, G), and G2's is the complement of sites 50, 47 and 46 (GCT, A).
+	// b has G15A and G47T, c has G10C and a change in G2's intron, and d has an N in G1's intron, an R (A or G) at
+	// site 15 and a synonymous change at site 46
+	characters, idx, states, err := TypeAlignment(tr, "testdata/spliced.fasta", configFile, "testdata/spliced.gb", "", 1, annotation.DefaultCDSNaming, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := map[string]map[string][]string{
+		"a": {"aa:g1:4": {"G"}, "aa:g2:4": {"A"}, "G1:G4E": {"absent"}},
+		"b": {"aa:g1:4": {"E"}, "aa:g2:4": {"D"}, "G1:G4E": {"present"}},
+		"c": {"aa:g1:4": {"R"}, "aa:g2:4": {"A"}, "G1:G4E": {"absent"}},
+		"d": {"aa:g1:4": {"E", "G"}, "aa:g2:4": {"A"}, "G1:G4E": {"absent", "present"}},
+	}
+	typed := make(map[string]map[string][]string)
+	for _, tip := range tr.Tips() {
+		typed[tip.Name()] = make(map[string][]string)
+		for i, c := range characters {
+			names := make([]string, 0)
+			for _, bit := range bitsets.GetSetBits(states[tip.Id()][idx[i].Start:idx[i].Stop]) {
+				names = append(names, c.StateKey[bit-1])
+			}
+			typed[tip.Name()][c.Name] = names
+		}
+	}
+	if !reflect.DeepEqual(typed, desiredResult) {
+		t.Errorf("error in Test_TypeAlignmentSpliced")
+	}
+
+	// masking a site in an intron doesn't mask the codon that spans it, but masking one of its sites does
+	report, err := MaskSites(states, idx, characters, []Segment{}, []MaskedSite{{Pos: 12, Reason: "intron"}, {Pos: 46, Reason: "codon"}})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(report) != 1 || report[0].Name != "aa:g2:4" || report[0].Reason != "codon" {
+		t.Errorf("error in Test_TypeAlignmentSpliced")
+	}
+}
@@ -0,0 +1,241 @@
+package characterio
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/ash/pkg/bitsets"
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+// NodeNames returns the name of every node, by id, for the outputs that need every node to be named: its name in the tree,
+// or for unnamed (internal) nodes, NODE_ and a number that counts them in preorder from NODE_0000000 at the root, as
+// augur refine names them
+func NodeNames(t *tree.Tree) []string {
+	nodes := t.Nodes()
+	// the newick parser numbers the nodes in preorder of the input tree, before they are sorted by depth
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Id() < nodes[j].Id() })
+	names := make([]string, len(nodes))
+	counter := 0
+	for _, n := range nodes {
+		if len(n.Name()) > 0 {
+			names[n.Id()] = n.Name()
+			continue
+		}
+		names[n.Id()] = fmt.Sprintf("NODE_%07d", counter)
+		counter++
+	}
+	return names
+}
+
+type auspiceJSON struct {
+	Version      string            `json:"version"`
+	Meta         auspiceMeta       `json:"meta"`
+	Tree         *auspiceNode      `json:"tree"`
+	RootSequence map[string]string `json:"root_sequence,omitempty"`
+}
+
+type auspiceMeta struct {
+	Title             string                       `json:"title"`
+	Updated           string                       `json:"updated"`
+	Panels            []string                     `json:"panels"`
+	Colorings         []auspiceColoring            `json:"colorings"`
+	Filters           []string                     `json:"filters,omitempty"`
+	GenomeAnnotations map[string]auspiceAnnotation `json:"genome_annotations,omitempty"`
+}
+
+type auspiceColoring struct {
+	Key   string `json:"key"`
+	Title string `json:"title"`
+	Type  string `json:"type"`
+}
+
+type auspiceAnnotation struct {
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Strand string `json:"strand"`
+	Type   string `json:"type,omitempty"`
+}
+
+type auspiceNode struct {
+	Name        string                 `json:"name"`
+	NodeAttrs   map[string]interface{} `json:"node_attrs"`
+	BranchAttrs *auspiceBranchAttrs    `json:"branch_attrs,omitempty"`
+	Children    []*auspiceNode         `json:"children,omitempty"`
+}
+
+type auspiceBranchAttrs struct {
+	Mutations map[string][]string `json:"mutations"`
+}
+
+// a reconstructed trait at a node. If the node has more than one state, they are equally likely
+type auspiceTrait struct {
+	Value      string             `json:"value"`
+	Confidence map[string]float64 `json:"confidence,omitempty"`
+}
+
+// the annotation of the genome, for Auspice: the whole (concatenated) genome, each CDS, and each mature peptide
+func genomeAnnotations(regions []annotation.Region) map[string]auspiceAnnotation {
+	annotations := make(map[string]auspiceAnnotation)
+	end := 0
+	for _, r := range regions {
+		if r.Stop > end {
+			end = r.Stop
+		}
+		if r.Whichtype != "CDS" {
+			continue
+		}
+		strand := "+"
+		if r.Complement {
+			strand = "-"
+		}
+		annotations[r.LabelPrefix()+r.Name] = auspiceAnnotation{Start: r.Start, End: r.Stop, Strand: strand, Type: "CDS"}
+		for _, p := range r.Peptides {
+			// the first site of the peptide's first codon and the last site of its last codon, in reading order
+			first, last := r.Codons[p.Start-1][0], r.Codons[p.Stop-1][2]
+			if r.Complement {
+				first, last = last, first
+			}
+			annotations[r.LabelPrefix()+p.Name] = auspiceAnnotation{Start: first, End: last, Strand: strand, Type: "mat_peptide"}
+		}
+	}
+	annotations["nuc"] = auspiceAnnotation{Start: 1, End: end, Strand: "+", Type: "source"}
+	return annotations
+}
+
+// the mutations on the branch above each node, keyed by "nuc" or the name of a CDS (or mature peptide). Nucleotide
+// mutations are at their positions in the (concatenated) genome, as the genome annotations are
+func branchMutations(records []TransitionRecord, regions []annotation.Region) map[int]map[string][]string {
+
+	IUPACMap := annotation.GetIUPACMap()
+	prefixes := make(map[string]string) // the segment prefix of each CDS
+	offsets := make(map[string]int)     // how many sites come before each segment
+	for _, r := range regions {
+		prefixes[r.Name] = r.LabelPrefix()
+		offsets[r.Segment] = r.Offset
+	}
+
+	// one letter for each state, so that the mutations are in the usual format (e.g. A241G)
+	code := func(s string) string {
+		nucs := strings.Split(s, "|")
+		sort.Strings(nucs)
+		if c, ok := IUPACMap[strings.Join(nucs, "")]; ok {
+			return c
+		}
+		return "N"
+	}
+
+	mutations := make(map[int]map[string][]string)
+	for _, r := range records {
+		m, ok := mutations[r.ChildID]
+		if !ok {
+			m = make(map[string][]string)
+			mutations[r.ChildID] = m
+		}
+		m["nuc"] = append(m["nuc"], code(r.Ancestral)+strconv.Itoa(offsets[r.Segment]+r.Position)+code(r.Derived))
+		for _, c := range r.Codons {
+			if c.Effect != "nonsynonymous" {
+				continue
+			}
+			gene := prefixes[c.CDS] + c.Protein
+			aa := c.AncestralAA + strconv.Itoa(c.Residue) + c.DerivedAA
+			if !stringInArray(aa, m[gene]) {
+				m[gene] = append(m[gene], aa)
+			}
+		}
+	}
+	return mutations
+}
+
+// the states of each character at a node, as Auspice node attributes
+func traitAttrs(characters []CharacterStruct, states [][]byte, idx []StartStop, id int, attrs map[string]interface{}) {
+	for i := range idx {
+		setbits := bitsets.GetSetBits(states[id][idx[i].Start:idx[i].Stop])
+		if len(setbits) == 0 {
+			continue
+		}
+		trait := auspiceTrait{Value: characters[i].StateKey[setbits[0]-1]}
+		if len(setbits) > 1 {
+			trait.Confidence = make(map[string]float64)
+			for _, b := range setbits {
+				trait.Confidence[characters[i].StateKey[b-1]] = 1 / float64(len(setbits))
+			}
+		}
+		attrs[characters[i].Name] = trait
+	}
+}
+
+// WriteAuspice writes the tree as an Auspice v2 JSON. If sites is true, the characters are the sites of the
+// (concatenated) alignment, and the branches get their nucleotide mutations and the amino acid changes in the
+// regions' CDSs. Otherwise, the characters (e.g. the columns of a tipfile) are written as traits of every node, with
+// ambiguous states as equal confidences. Divergence is in branch lengths, or in mutations if the tree has none
+func WriteAuspice(filename string, t *tree.Tree, characters []CharacterStruct, states [][]byte, idx []StartStop, regions []annotation.Region, sites bool) error {
+
+	meta := auspiceMeta{Title: "ash", Updated: time.Now().Format("2006-01-02"), Panels: []string{"tree"}, Colorings: []auspiceColoring{}}
+
+	var mutations map[int]map[string][]string
+	if sites {
+		mutations = branchMutations(GetTransitions(t, characters, states, idx, regions), regions)
+		meta.Colorings = append(meta.Colorings, auspiceColoring{Key: "gt", Title: "Genotype", Type: "categorical"})
+		if len(regions) > 0 {
+			meta.Panels = append(meta.Panels, "entropy")
+			meta.GenomeAnnotations = genomeAnnotations(regions)
+		}
+	} else {
+		for _, c := range characters {
+			meta.Colorings = append(meta.Colorings, auspiceColoring{Key: c.Name, Title: c.Name, Type: "categorical"})
+			meta.Filters = append(meta.Filters, c.Name)
+		}
+	}
+
+	names := NodeNames(t)
+
+	var build func(cur, prev *tree.Node, div float64) *auspiceNode
+	build = func(cur, prev *tree.Node, div float64) *auspiceNode {
+		n := &auspiceNode{Name: names[cur.Id()], NodeAttrs: make(map[string]interface{})}
+		n.NodeAttrs["div"] = div
+		if m, ok := mutations[cur.Id()]; ok {
+			n.BranchAttrs = &auspiceBranchAttrs{Mutations: m}
+		}
+		if !sites {
+			traitAttrs(characters, states, idx, cur.Id(), n.NodeAttrs)
+		}
+		for i, child := range cur.Neigh() {
+			if child == prev {
+				continue
+			}
+			length := cur.Edges()[i].Length()
+			if length == tree.NIL_LENGTH {
+				length = float64(len(mutations[child.Id()]["nuc"]))
+			}
+			n.Children = append(n.Children, build(child, cur, div+length))
+		}
+		return n
+	}
+
+	aj := auspiceJSON{Version: "v2", Meta: meta, Tree: build(t.Root(), nil, 0)}
+	if sites {
+		aj.RootSequence = map[string]string{"nuc": sequenceAt(characters, states, t.Root().Id(), 0, len(characters))}
+	}
+
+	b, err := json.MarshalIndent(aj, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+
+	return err
+}
@@ -0,0 +1,146 @@
+package characterio
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+func Test_genomeAnnotations(t *testing.T) {
+	// P's second peptide starts at a codon that spans an intron, and Q is on the minus strand
+	regions := []annotation.Region{
+		{Whichtype: "int", Start: 1, Stop: 10},
+		{Whichtype: "CDS", Name: "P", Start: 11, Stop: 22, Codons: [][3]int{{11, 12, 13}, {14, 15, 18}, {19, 20, 21}},
+			Peptides: []annotation.Peptide{{Name: "p1", Start: 1, Stop: 1}, {Name: "p2", Start: 2, Stop: 3}}},
+		{Whichtype: "int", Start: 16, Stop: 17},
+		{Whichtype: "CDS", Name: "Q", Start: 31, Stop: 39, Complement: true, Codons: [][3]int{{39, 38, 37}, {36, 35, 34}, {33, 32, 31}},
+			Peptides: []annotation.Peptide{{Name: "q2", Start: 2, Stop: 3}}},
+		{Whichtype: "int", Start: 40, Stop: 40},
+	}
+
+	desiredResult := map[string]auspiceAnnotation{
+		"nuc": {Start: 1, End: 40, Strand: "+", Type: "source"},
+		"P":   {Start: 11, End: 22, Strand: "+", Type: "CDS"},
+		"p1":  {Start: 11, End: 13, Strand: "+", Type: "mat_peptide"},
+		"p2":  {Start: 14, End: 21, Strand: "+", Type: "mat_peptide"},
+		"Q":   {Start: 31, End: 39, Strand: "-", Type: "CDS"},
+		"q2":  {Start: 31, End: 36, Strand: "-", Type: "mat_peptide"},
+	}
+	if !reflect.DeepEqual(genomeAnnotations(regions), desiredResult) {
+		t.Errorf("error in Test_genomeAnnotations")
+	}
+}
+
+func Test_branchMutations(t *testing.T) {
+	regions := []annotation.Region{{Whichtype: "CDS", Name: "HA1", Segment: "HA", Offset: 100}}
+	S := []CodonChange{{CDS: "S", Protein: "S", Residue: 614, AncestralAA: "D", DerivedAA: "G", Effect: "nonsynonymous"}}
+	syn := []CodonChange{{CDS: "S", Protein: "S", Residue: 614, AncestralAA: "D", DerivedAA: "D", Effect: "synonymous"}}
+	HA1 := []CodonChange{{CDS: "HA1", Protein: "HA1", Residue: 2, AncestralAA: "K", DerivedAA: "R", Effect: "nonsynonymous"}}
+
+	tests := []struct {
+		records       []TransitionRecord
+		desiredResult map[int]map[string][]string
+	}{
+		{[]TransitionRecord{{Position: 23403, Ancestral: "A", Derived: "G", ChildID: 3, Codons: S}},
+			map[int]map[string][]string{3: {"nuc": {"A23403G"}, "S": {"D614G"}}}},
+		// ambiguous states as IUPAC codes, and synonymous changes aren't amino acid mutations
+		{[]TransitionRecord{{Position: 23404, Ancestral: "A|G", Derived: "C|G|T", ChildID: 3, Codons: syn}, {Position: 10, Ancestral: "C", Derived: "T", ChildID: 4}},
+			map[int]map[string][]string{3: {"nuc": {"R23404B"}}, 4: {"nuc": {"C10T"}}}},
+		// nucleotide mutations on a segment are at their positions in the concatenated genome, and the segment is a
+		// prefix of the CDS
+		{[]TransitionRecord{{Segment: "HA", Position: 5, Ancestral: "A", Derived: "G", ChildID: 1, Codons: HA1}},
+			map[int]map[string][]string{1: {"nuc": {"A105G"}, "HA:HA1": {"K2R"}}}},
+	}
+
+	for _, test := range tests {
+		if !reflect.DeepEqual(branchMutations(test.records, regions), test.desiredResult) {
+			t.Errorf("error in Test_branchMutations")
+		}
+	}
+}
+
+func Test_traitAttrs(t *testing.T) {
+	characters := []CharacterStruct{{Name: "host", StateKey: []string{"bat", "human", "pangolin"}}}
+	idx := []StartStop{{Start: 0, Stop: 1}}
+
+	tests := []struct {
+		state         byte
+		desiredResult map[string]interface{}
+	}{
+		{64, map[string]interface{}{"host": auspiceTrait{Value: "human"}}},
+		// ambiguous states are equally likely
+		{160, map[string]interface{}{"host": auspiceTrait{Value: "bat", Confidence: map[string]float64{"bat": 0.5, "pangolin": 0.5}}}},
+		// missing data isn't an attribute
+		{0, map[string]interface{}{}},
+	}
+
+	for _, test := range tests {
+		attrs := make(map[string]interface{})
+		traitAttrs(characters, [][]byte{{test.state}}, idx, 0, attrs)
+		if !reflect.DeepEqual(attrs, test.desiredResult) {
+			t.Errorf("error in Test_traitAttrs")
+		}
+	}
+}
+
+func Test_WriteAuspice(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a:1,b:2):1,c:1);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the states of the root, the internal node, then a, b and c
+	characters := []CharacterStruct{{Name: "host", StateKey: []string{"bat", "human"}}}
+	idx := []StartStop{{Start: 0, Stop: 1}}
+	states := [][]byte{{128}, {128}, {128}, {64}, {128}}
+
+	auspiceFile := filepath.Join(t.TempDir(), "tree.json")
+	err = WriteAuspice(auspiceFile, tr, characters, states, idx, []annotation.Region{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(auspiceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var aj auspiceJSON
+	err = json.Unmarshal(b, &aj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aj.Version != "v2" || !reflect.DeepEqual(aj.Meta.Colorings, []auspiceColoring{{Key: "host", Title: "host", Type: "categorical"}}) {
+		t.Errorf("error in Test_WriteAuspice")
+	}
+
+	// every node's name, divergence and host, in preorder
+	type node struct {
+		name string
+		div  float64
+		host string
+	}
+	nodes := make([]node, 0)
+	var walk func(an *auspiceNode)
+	walk = func(an *auspiceNode) {
+		host, _ := an.NodeAttrs["host"].(map[string]interface{})
+		value, _ := host["value"].(string)
+		div, _ := an.NodeAttrs["div"].(float64)
+		nodes = append(nodes, node{an.Name, div, value})
+		for _, child := range an.Children {
+			walk(child)
+		}
+	}
+	walk(aj.Tree)
+
+	desiredResult := []node{{"NODE_0000000", 0, "bat"}, {"NODE_0000001", 1, "bat"}, {"a", 2, "bat"}, {"b", 3, "human"}, {"c", 1, "bat"}}
+	if !reflect.DeepEqual(nodes, desiredResult) {
+		t.Errorf("error in Test_WriteAuspice")
+	}
+}
@@ -0,0 +1,185 @@
+package characterio
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+// Cluster is the clade below one transition
+type Cluster struct {
+	Name       string // the transition's label, e.g. nuc:23403=A->G#2
+	Character  string
+	Transition string         // e.g. A->G#2
+	Tips       []string       // the tips below the transition
+	Counts     map[string]int // how many of the tips have each state ("missing" for missing data)
+	Newick     string         // the subtree below the transition
+}
+
+// GetClusters gets the clade below every transition that has more than threshold tips below it
+func GetClusters(threshold int, transitions [][]Transition, characters []CharacterStruct, states [][]byte, idx []StartStop) []Cluster {
+
+	clusters := make([]Cluster, 0)
+
+	for i := range transitions {
+		for _, trans := range transitions[i] {
+			tips := make([]*tree.Node, 0)
+			childTips(trans.Downnode, trans.Upnode, &tips)
+			if !(len(tips) > threshold) {
+				continue
+			}
+
+			c := Cluster{
+				Character:  characters[i].Name,
+				Transition: strings.Split(trans.Label, ",")[1],
+				Tips:       make([]string, len(tips)),
+				Counts:     summarizeTransitions(trans, states, idx[i], characters[i]),
+				Newick:     subtreeNewick(trans.Downnode, trans.Upnode) + ";",
+			}
+			c.Name = c.Character + "=" + c.Transition
+			for j, tip := range tips {
+				c.Tips[j] = tip.Name()
+			}
+
+			clusters = append(clusters, c)
+		}
+	}
+
+	return clusters
+}
+
+// the newick string of the subtree below cur, with its tip names and branch lengths (but not ash's labels)
+func subtreeNewick(cur, prev *tree.Node) string {
+	if cur.Tip() {
+		return cur.Name()
+	}
+	children := make([]string, 0)
+	for i, n := range cur.Neigh() {
+		if n == prev {
+			continue
+		}
+		child := subtreeNewick(n, cur)
+		if l := cur.Edges()[i].Length(); l != tree.NIL_LENGTH {
+			child = child + ":" + strconv.FormatFloat(l, 'f', -1, 64)
+		}
+		children = append(children, child)
+	}
+	return "(" + strings.Join(children, ",") + ")" + cur.Name()
+}
+
+// WriteClusters writes each cluster's subtree (<name>.nwk) and, if sequencesFile isn't empty, the sequences of its tips
+// from it (<name>.fasta) to outdir, with an index of the clusters (index.tsv). Files are named by the cluster's name,
+// with anything but letters, digits, '.', '_' and '-' replaced by '_' (and a number added if that clashes)
+func WriteClusters(outdir string, clusters []Cluster, sequencesFile string) error {
+
+	err := os.MkdirAll(outdir, 0755)
+	if err != nil {
+		return err
+	}
+
+	var sequences map[string]string
+	if len(sequencesFile) > 0 {
+		wanted := make(map[string]bool)
+		for _, c := range clusters {
+			for _, tip := range c.Tips {
+				wanted[tip] = true
+			}
+		}
+		sequences, err = readFastaRecords(sequencesFile, wanted)
+		if err != nil {
+			return err
+		}
+	}
+
+	index, err := os.Create(filepath.Join(outdir, "index.tsv"))
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+
+	_, err = index.WriteString("cluster\tcharacter\ttransition\ttips\tstate_counts\tnewick\tfasta\n")
+	if err != nil {
+		return err
+	}
+
+	used := make(map[string]bool)
+	for _, c := range clusters {
+		filename := clusterFilename(c.Name, used)
+
+		newickFile := filename + ".nwk"
+		err = os.WriteFile(filepath.Join(outdir, newickFile), []byte(c.Newick+"\n"), 0644)
+		if err != nil {
+			return err
+		}
+
+		fastaFile := ""
+		if sequences != nil {
+			fastaFile = filename + ".fasta"
+			var sb strings.Builder
+			for _, tip := range c.Tips {
+				if seq, ok := sequences[tip]; ok {
+					sb.WriteString(">" + tip + "\n" + seq + "\n")
+				}
+			}
+			err = os.WriteFile(filepath.Join(outdir, fastaFile), []byte(sb.String()), 0644)
+			if err != nil {
+				return err
+			}
+		}
+
+		states := make([]string, 0, len(c.Counts))
+		for state := range c.Counts {
+			states = append(states, state)
+		}
+		sort.Strings(states)
+		counts := make([]string, len(states))
+		for i, state := range states {
+			counts[i] = state + ":" + strconv.Itoa(c.Counts[state])
+		}
+
+		_, err = index.WriteString(c.Name + "\t" + c.Character + "\t" + c.Transition + "\t" + strconv.Itoa(len(c.Tips)) + "\t" +
+			strings.Join(counts, ";") + "\t" + newickFile + "\t" + fastaFile + "\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// a name for a cluster's files that is safe on any filesystem, and that isn't already used
+func clusterFilename(name string, used map[string]bool) string {
+	safe := []byte(name)
+	for i, c := range safe {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			safe[i] = '_'
+		}
+	}
+	filename := string(safe)
+	for i := 2; used[filename]; i++ {
+		filename = string(safe) + "_" + strconv.Itoa(i)
+	}
+	used[filename] = true
+	return filename
+}
+
+// read the wanted records from a fasta file, by ID
+func readFastaRecords(fastaFile string, wanted map[string]bool) (map[string]string, error) {
+
+	fastaRecords, err := annotation.ReadFasta(fastaFile, func(id string) bool { return wanted[id] }, 0)
+	if err != nil {
+		return map[string]string{}, err
+	}
+
+	records := make(map[string]string)
+	for _, r := range fastaRecords {
+		records[r.ID] = r.Seq
+	}
+
+	return records, nil
+}
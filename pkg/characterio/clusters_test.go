@@ -0,0 +1,99 @@
+package characterio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+func Test_clusterFilename(t *testing.T) {
+	used := make(map[string]bool)
+
+	tests := []struct {
+		name          string
+		desiredResult string
+	}{
+		{"nuc:23403=A->G#2", "nuc_23403_A-_G_2"},
+		{"S:D614G=absent->present#1", "S_D614G_absent-_present_1"},
+		{"host=bat->human#1", "host_bat-_human_1"},
+		{"clade_1.2-b", "clade_1.2-b"},
+		// names that are only different in characters that are replaced
+		{"host=bat->human/1", "host_bat-_human_1_2"},
+		{"host=bat->human 1", "host_bat-_human_1_3"},
+	}
+
+	for _, test := range tests {
+		if clusterFilename(test.name, used) != test.desiredResult {
+			t.Errorf("error in Test_clusterFilename")
+		}
+	}
+}
+
+func Test_WriteClusters(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a:1,b:2):1,(c:1,d:1):1);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.UpdateTipIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	characters, idx, states, err := TypeAlignmentNuc(tr, "testdata/typing.fasta", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nuc:6 changes A->G above (a,b) and (c,d), and G->A above a. The last is a single tip, so isn't a cluster
+	nodes := tr.Nodes()
+	transitions := make([][]Transition, len(characters))
+	transitions[5] = []Transition{
+		{Upnode: nodes[0], Downnode: nodes[1], Label: "nuc:6=A->G,A->G#1"},
+		{Upnode: nodes[1], Downnode: nodes[2], Label: "nuc:6=G->A,G->A#1"},
+		{Upnode: nodes[0], Downnode: nodes[4], Label: "nuc:6=A->G,A->G#2"},
+	}
+
+	clusters := GetClusters(1, transitions, characters, states, idx)
+	if len(clusters) != 2 {
+		t.Fatalf("error in Test_WriteClusters")
+	}
+	if clusters[0].Name != "nuc:6=A->G#1" || !reflect.DeepEqual(clusters[0].Tips, []string{"a", "b"}) ||
+		!reflect.DeepEqual(clusters[0].Counts, map[string]int{"A": 1, "G": 1}) || clusters[0].Newick != "(a:1,b:2);" {
+		t.Errorf("error in Test_WriteClusters")
+	}
+	// c has a gap at nuc:6, and d an R
+	if !reflect.DeepEqual(clusters[1].Counts, map[string]int{"missing": 1, "A|G": 1}) {
+		t.Errorf("error in Test_WriteClusters")
+	}
+
+	outdir := filepath.Join(t.TempDir(), "clusters")
+	err = WriteClusters(outdir, clusters, "testdata/typing.fasta")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file          string
+		desiredResult string
+	}{
+		{"index.tsv", "cluster\tcharacter\ttransition\ttips\tstate_counts\tnewick\tfasta\n" +
+			"nuc:6=A->G#1\tnuc:6\tA->G#1\t2\tA:1;G:1\tnuc_6_A-_G_1.nwk\tnuc_6_A-_G_1.fasta\n" +
+			"nuc:6=A->G#2\tnuc:6\tA->G#2\t2\tA|G:1;missing:1\tnuc_6_A-_G_2.nwk\tnuc_6_A-_G_2.fasta\n"},
+		{"nuc_6_A-_G_1.nwk", "(a:1,b:2);\n"},
+		{"nuc_6_A-_G_1.fasta", ">a\nATGGAACGTTAA---TTAAAATTTCATGGG\n>b\nATGGAGCGTTAACCATTAAAATTTCATGGG\n"},
+		{"nuc_6_A-_G_2.nwk", "(c:1,d:1);\n"},
+	}
+
+	for _, test := range tests {
+		contents, err := os.ReadFile(filepath.Join(outdir, test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != test.desiredResult {
+			t.Errorf("error in Test_WriteClusters")
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package characterio
+
+import (
+	"sort"
+)
+
+// expand a codon which may contain IUPAC ambiguity codes into all the unambiguous codons it is compatible
+// with, and return all the amino acids that these code for. Codons with gaps, unknown characters or an N give an
+// empty slice, which is missing data: an N is missing data here as it is at a nucleotide site, not any nucleotide
+func translateCodon(codon string, codonMap map[string]string, nucArr [][]string) []string {
+
+	if len(codon) != 3 {
+		return []string{}
+	}
+
+	codons := []string{""}
+	for i := 0; i < 3; i++ {
+		nucs := nucArr[codon[i]]
+		if len(nucs) == 0 {
+			return []string{}
+		}
+		temp := make([]string, 0, len(codons)*len(nucs))
+		for _, c := range codons {
+			for _, nuc := range nucs {
+				temp = append(temp, c+nuc)
+			}
+		}
+		codons = temp
+	}
+
+	aas := make([]string, 0)
+	for _, c := range codons {
+		aa, ok := codonMap[c]
+		if !ok {
+			return []string{}
+		}
+		if !stringInArray(aa, aas) {
+			aas = append(aas, aa)
+		}
+	}
+	sort.Strings(aas)
+
+	return aas
+}
@@ -0,0 +1,42 @@
+package characterio
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+)
+
+func Test_translateCodon(t *testing.T) {
+	nucArr := makeNucLookupArray()
+
+	tests := []struct {
+		codon         string
+		table         int
+		desiredResult []string
+	}{
+		{"GAA", 1, []string{"E"}},
+		// GAR can only be E, but RAT is D or N, and VTG is L, M or V
+		{"GAR", 1, []string{"E"}},
+		{"RAT", 1, []string{"D", "N"}},
+		{"VTG", 1, []string{"L", "M", "V"}},
+		{"TRA", 1, []string{"*"}},
+		// TGA is W in the mitochondrial code
+		{"TGR", 2, []string{"W"}},
+		// missing data. An N is missing data, as it is at a nucleotide site
+		{"NNN", 1, []string{}},
+		{"NTG", 1, []string{}},
+		{"GA-", 1, []string{}},
+		{"GA", 1, []string{}},
+	}
+
+	for _, test := range tests {
+		codonMap, err := annotation.GeneticCode(test.table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(translateCodon(test.codon, codonMap, nucArr), test.desiredResult) {
+			t.Errorf("error in Test_translateCodon")
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package characterio
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/ash/pkg/bitsets"
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+// MaskedSite is a site that is set to missing data for every tip before the reconstruction, e.g. a known
+// problematic site
+type MaskedSite struct {
+	Chrom  string // the sequence the site is on (only used for multi-segment genomes)
+	Pos    int    // 1-based position
+	Reason string // why it is masked, for the report
+}
+
+// MaskReport is one line of the report of what was masked
+type MaskReport struct {
+	What   string // "site" or "tip"
+	Name   string // the character's or the tip's name
+	Reason string
+}
+
+// ReadMaskSites reads the sites to mask from a VCF (.vcf, e.g. the SARS-CoV-2 problematic sites, whose FILTER and INFO
+// columns are the reason), a BED file (.bed, whose names are the reason), or otherwise a list with one site ("pos" or
+// "start-stop", optionally with "chrom:" first) and an optional reason per line
+func ReadMaskSites(maskFile string) ([]MaskedSite, error) {
+
+	format := strings.ToLower(filepath.Ext(maskFile))
+	source := filepath.Base(maskFile)
+
+	sites := make([]MaskedSite, 0)
+
+	if format == ".bed" {
+		features, err := annotation.ReadBED(maskFile)
+		if err != nil {
+			return []MaskedSite{}, err
+		}
+		for _, F := range features {
+			for pos := F.Start; pos <= F.Stop; pos++ {
+				sites = append(sites, MaskedSite{Chrom: F.Chrom, Pos: pos, Reason: source + ": " + F.Name})
+			}
+		}
+		return sites, nil
+	}
+
+	f, err := os.Open(maskFile)
+	if err != nil {
+		return []MaskedSite{}, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var chrom, reason string
+		var start, stop int
+
+		switch format {
+		case ".vcf":
+			fields := strings.Split(line, "\t")
+			if len(fields) < 2 {
+				return []MaskedSite{}, errors.New("badly formatted VCF line: " + line)
+			}
+			chrom = fields[0]
+			start, err = strconv.Atoi(fields[1])
+			if err != nil {
+				return []MaskedSite{}, errors.New("badly formatted VCF position: " + line)
+			}
+			stop = start
+			reasons := make([]string, 0)
+			for _, i := range []int{6, 7} { // FILTER and INFO
+				if len(fields) > i && fields[i] != "." && len(fields[i]) > 0 {
+					reasons = append(reasons, fields[i])
+				}
+			}
+			reason = strings.Join(reasons, ";")
+		default:
+			fields := strings.Fields(line)
+			site := fields[0]
+			if i := strings.LastIndex(site, ":"); i != -1 {
+				chrom = site[:i]
+				site = site[i+1:]
+			}
+			start, stop, err = parseRange(site)
+			if err != nil || start < 1 {
+				return []MaskedSite{}, errors.New("badly formatted site to mask: " + line)
+			}
+			reason = strings.Join(fields[1:], " ")
+		}
+
+		if len(reason) == 0 {
+			reason = source
+		} else {
+			reason = source + ": " + reason
+		}
+
+		for pos := start; pos <= stop; pos++ {
+			sites = append(sites, MaskedSite{Chrom: chrom, Pos: pos, Reason: reason})
+		}
+	}
+
+	err = s.Err()
+	if err != nil {
+		return []MaskedSite{}, err
+	}
+
+	return sites, nil
+}
+
+// the 1-based sites of the alignment that a character is typed from
+func characterSites(v variant) []int {
+	switch {
+	case v.vtype == "aa" || v.vtype == "aaallele":
+		// a codon can span an intron
+		return v.vcodon[:]
+	case v.vlength > 0:
+		sites := make([]int, 0, v.vlength)
+		for pos := v.vpos; pos < v.vpos+v.vlength; pos++ {
+			sites = append(sites, pos)
+		}
+		return sites
+	}
+	return []int{v.vpos}
+}
+
+// MaskSites sets every character that is typed from any of the masked sites to missing data, for every node. For
+// multi-segment genomes, each site's Chrom must be the name of a segment. It returns what was masked and why
+func MaskSites(states [][]byte, idx []StartStop, characterStates []CharacterStruct, segments []Segment, sites []MaskedSite) ([]MaskReport, error) {
+
+	report := make([]MaskReport, 0)
+
+	// nothing to mask (e.g. only tips with too much missing data are masked), so the characters can be of any kind
+	if len(sites) == 0 {
+		return report, nil
+	}
+
+	offsets := make(map[string]int)
+	for _, segment := range segments {
+		offsets[segment.Name] = segment.Offset
+	}
+
+	// the reasons for masking each (1-based) site of the (concatenated) alignment
+	reasons := make(map[int]map[string]bool)
+	for _, site := range sites {
+		pos := site.Pos
+		if len(segments) > 0 {
+			offset, ok := offsets[site.Chrom]
+			if !ok {
+				return []MaskReport{}, errors.New("site to mask is on an unknown segment: " + site.Chrom + ":" + strconv.Itoa(site.Pos))
+			}
+			pos = offset + site.Pos
+		}
+		if _, ok := reasons[pos]; !ok {
+			reasons[pos] = make(map[string]bool)
+		}
+		reasons[pos][site.Reason] = true
+	}
+
+	for i, cs := range characterStates {
+		if cs.V.vpos == 0 {
+			return []MaskReport{}, errors.New("can't mask sites of characters that aren't typed from an alignment: " + cs.Name)
+		}
+		offset := 0
+		if len(segments) > 0 {
+			for _, segment := range segments {
+				if i >= segment.Offset && i < segment.Offset+segment.Length {
+					offset = segment.Offset
+					break
+				}
+			}
+		}
+
+		why := make(map[string]bool)
+		for _, pos := range characterSites(cs.V) {
+			for r := range reasons[pos+offset] {
+				why[r] = true
+			}
+		}
+		if len(why) == 0 {
+			continue
+		}
+
+		for j := range states {
+			for k := idx[i].Start; k < idx[i].Stop; k++ {
+				states[j][k] = 0
+			}
+		}
+		whys := make([]string, 0, len(why))
+		for r := range why {
+			whys = append(whys, r)
+		}
+		sort.Strings(whys)
+		report = append(report, MaskReport{What: "site", Name: cs.Name, Reason: strings.Join(whys, ", ")})
+	}
+
+	return report, nil
+}
+
+// MissingFractions returns the fraction of the characters that each tip has no state for (e.g. Ns), by tip name
+func MissingFractions(t *tree.Tree, states [][]byte, idx []StartStop) map[string]float64 {
+	fractions := make(map[string]float64)
+	for _, tip := range t.Tips() {
+		missing := 0
+		for i := range idx {
+			if !bitsets.IsAnyBitSet(states[tip.Id()][idx[i].Start:idx[i].Stop]) {
+				missing++
+			}
+		}
+		fractions[tip.Name()] = float64(missing) / float64(len(idx))
+	}
+	return fractions
+}
+
+// MaskTips sets every character of each of the named tips to missing data
+func MaskTips(t *tree.Tree, states [][]byte, tips []string) error {
+	for _, tip := range tips {
+		id, err := t.TipId(tip)
+		if err != nil {
+			return err
+		}
+		for k := range states[id] {
+			states[id][k] = 0
+		}
+	}
+	return nil
+}
+
+// PruneTips returns a copy of the tree without the named tips, and the states rearranged to match its node ids.
+// Internal nodes that are left with one child are removed, and their branches are joined
+func PruneTips(t *tree.Tree, states [][]byte, tips []string) (*tree.Tree, [][]byte, error) {
+
+	prune := make(map[string]bool)
+	for _, tip := range tips {
+		prune[tip] = true
+	}
+
+	pruned := tree.NewTree()
+	nnodes := 0
+
+	// copy the subtree below cur, and return its root, and the length of any branch below it that is absorbed
+	// into the branch above it because cur was removed. Returns nil if all its tips are pruned
+	var copySubtree func(cur, prev *tree.Node) (*tree.Node, float64)
+	copySubtree = func(cur, prev *tree.Node) (*tree.Node, float64) {
+		if cur.Tip() && prev != nil {
+			if prune[cur.Name()] {
+				return nil, tree.NIL_LENGTH
+			}
+			n := pruned.NewNode()
+			n.SetName(cur.Name())
+			return n, tree.NIL_LENGTH
+		}
+
+		type child struct {
+			node   *tree.Node
+			length float64
+			edge   *tree.Edge
+		}
+		children := make([]child, 0)
+		for i, neighbour := range cur.Neigh() {
+			if neighbour == prev {
+				continue
+			}
+			n, extra := copySubtree(neighbour, cur)
+			if n == nil {
+				continue
+			}
+			children = append(children, child{node: n, length: joinLengths(cur.Edges()[i].Length(), extra), edge: cur.Edges()[i]})
+		}
+
+		switch len(children) {
+		case 0:
+			return nil, tree.NIL_LENGTH
+		case 1:
+			return children[0].node, children[0].length
+		}
+
+		n := pruned.NewNode()
+		n.SetName(cur.Name())
+		for _, c := range children {
+			e := pruned.ConnectNodes(n, c.node)
+			e.SetLength(c.length)
+			e.SetSupport(c.edge.Support())
+		}
+		return n, tree.NIL_LENGTH
+	}
+
+	root, _ := copySubtree(t.Root(), nil)
+	if root == nil || len(root.Neigh()) == 0 {
+		return new(tree.Tree), [][]byte{}, errors.New("fewer than two tips are left in the tree after pruning")
+	}
+	pruned.SetRoot(root)
+
+	// number the nodes in preorder (the order Nodes() walks the tree in) before they are sorted by depth. The newick
+	// parser numbers nodes in the order it creates them, which is the preorder of the newick string, so this numbers the
+	// pruned tree as reading it from a newick file would
+	for _, n := range pruned.Nodes() {
+		n.SetId(nnodes)
+		nnodes++
+	}
+
+	pruned.MaxDepthRooted(pruned.Root(), nil)
+	pruned.SortNeighborsByDepth(pruned.Root(), nil)
+	err := pruned.UpdateTipIndex()
+	if err != nil {
+		return new(tree.Tree), [][]byte{}, err
+	}
+
+	l := 0
+	if len(states) > 0 {
+		l = len(states[0])
+	}
+	newStates := make([][]byte, nnodes)
+	for _, n := range pruned.Nodes() {
+		if n.Tip() {
+			id, err := t.TipId(n.Name())
+			if err != nil {
+				return new(tree.Tree), [][]byte{}, err
+			}
+			newStates[n.Id()] = states[id]
+		} else {
+			newStates[n.Id()] = make([]byte, l)
+		}
+	}
+
+	return pruned, newStates, nil
+}
+
+// the length of two branches joined end to end
+func joinLengths(a, b float64) float64 {
+	switch {
+	case a == tree.NIL_LENGTH:
+		return b
+	case b == tree.NIL_LENGTH:
+		return a
+	}
+	return a + b
+}
+
+// WriteMaskReport writes what was masked, and why, as TSV
+func WriteMaskReport(f *os.File, report []MaskReport) error {
+	sort.SliceStable(report, func(i, j int) bool { return report[i].What < report[j].What })
+	_, err := f.WriteString("masked\tname\treason\n")
+	if err != nil {
+		return err
+	}
+	for _, r := range report {
+		_, err = f.WriteString(r.What + "\t" + r.Name + "\t" + r.Reason + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package characterio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/ash/pkg/bitsets"
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+func Test_ReadMaskSites(t *testing.T) {
+	tests := []struct {
+		filename      string
+		contents      string
+		desiredResult []MaskedSite
+	}{
+		{"sites.txt", "# a comment\n6 homoplasic site\n\nS2:2-3\n", []MaskedSite{
+			{Chrom: "", Pos: 6, Reason: "sites.txt: homoplasic site"},
+			{Chrom: "S2", Pos: 2, Reason: "sites.txt"},
+			{Chrom: "S2", Pos: 3, Reason: "sites.txt"},
+		}},
+		{"problematic.vcf", "##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\nMN908947.3\t187\t.\tA\t.\t.\tmask\tAC=1\nMN908947.3\t241\t.\tC\t.\t.\t.\t.\n", []MaskedSite{
+			{Chrom: "MN908947.3", Pos: 187, Reason: "problematic.vcf: mask;AC=1"},
+			{Chrom: "MN908947.3", Pos: 241, Reason: "problematic.vcf"},
+		}},
+		// BED is 0-based and half-open
+		{"sites.bed", "chr\t4\t6\tprimer\n", []MaskedSite{
+			{Chrom: "chr", Pos: 5, Reason: "sites.bed: primer"},
+			{Chrom: "chr", Pos: 6, Reason: "sites.bed: primer"},
+		}},
+	}
+
+	for _, test := range tests {
+		maskFile := filepath.Join(t.TempDir(), test.filename)
+		err := os.WriteFile(maskFile, []byte(test.contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sites, err := ReadMaskSites(maskFile)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(sites, test.desiredResult) {
+			t.Errorf("error in Test_ReadMaskSites")
+		}
+	}
+
+	for _, bad := range []string{"six\n", "0\n", "5-2\n"} {
+		maskFile := filepath.Join(t.TempDir(), "sites.txt")
+		err := os.WriteFile(maskFile, []byte(bad), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ReadMaskSites(maskFile)
+		if err == nil {
+			t.Errorf("error in Test_ReadMaskSites")
+		}
+	}
+}
+
+func Test_MaskSites(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(configFile, []byte("nuc:1\nnuc:6\naa:G1:2\ndel:4:3\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := typingTree(t)
+	characters, idx, states, err := TypeAlignment(tr, "testdata/typing.fasta", configFile, "testdata/typing.gb", "", 1, annotation.DefaultCDSNaming, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// site 6 is in the codon and the deletion, and no character is typed from site 2
+	sites := []MaskedSite{{Pos: 6, Reason: "homoplasic"}, {Pos: 2, Reason: "primer"}}
+	report, err := MaskSites(states, idx, characters, []Segment{}, sites)
+	if err != nil {
+		t.Error(err)
+	}
+
+	reasons := make(map[string]string)
+	for _, r := range report {
+		if r.What != "site" {
+			t.Errorf("error in Test_MaskSites")
+		}
+		reasons[r.Name] = r.Reason
+	}
+	desiredReasons := map[string]string{"nuc:6": "homoplasic", "aa:g1:2": "homoplasic", "del:4:3": "homoplasic"}
+	if !reflect.DeepEqual(reasons, desiredReasons) {
+		t.Errorf("error in Test_MaskSites")
+	}
+
+	for i, c := range characters {
+		for _, tip := range tr.Tips() {
+			missing := !bitsets.IsAnyBitSet(states[tip.Id()][idx[i].Start:idx[i].Stop])
+			if missing != (len(desiredReasons[c.Name]) > 0) && tip.Name() != "d" {
+				t.Errorf("error in Test_MaskSites")
+			}
+		}
+	}
+
+	_, err = MaskSites(states, idx, characters, []Segment{{Name: "S1", Offset: 0, Length: 4}}, []MaskedSite{{Chrom: "S2", Pos: 1}})
+	if err == nil {
+		t.Errorf("error in Test_MaskSites")
+	}
+
+	// with no sites to mask, the characters don't have to be typed from an alignment
+	report, err = MaskSites([][]byte{{128}}, []StartStop{{Start: 0, Stop: 1}}, []CharacterStruct{{Name: "host"}}, []Segment{}, []MaskedSite{})
+	if err != nil || len(report) != 0 {
+		t.Errorf("error in Test_MaskSites")
+	}
+}
+
+func Test_MissingFractions(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(configFile, []byte("nuc:1\nnuc:6\naa:G1:2\ndel:4:3\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := typingTree(t)
+	_, idx, states, err := TypeAlignment(tr, "testdata/typing.fasta", configFile, "testdata/typing.gb", "", 1, annotation.DefaultCDSNaming, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// c has a gap at site 6 and in G1's second codon, and d an N at site 1
+	desiredResult := map[string]float64{"a": 0, "b": 0, "c": 0.5, "d": 0.25}
+	if !reflect.DeepEqual(MissingFractions(tr, states, idx), desiredResult) {
+		t.Errorf("error in Test_MissingFractions")
+	}
+
+	err = MaskTips(tr, states, []string{"a"})
+	if err != nil {
+		t.Error(err)
+	}
+	desiredResult["a"] = 1
+	if !reflect.DeepEqual(MissingFractions(tr, states, idx), desiredResult) {
+		t.Errorf("error in Test_MissingFractions")
+	}
+
+	err = MaskTips(tr, states, []string{"e"})
+	if err == nil {
+		t.Errorf("error in Test_MissingFractions")
+	}
+}
+
+func Test_PruneTips(t *testing.T) {
+	tests := []struct {
+		prune         []string
+		desiredResult string
+	}{
+		{[]string{}, "((a:1,b:2)ab:3,(c:4,d:5)cd:6)root;"},
+		// cd is left with one child, so it is removed and its branch joined to d's, and the shallower subtree is sorted first
+		{[]string{"c"}, "(d:11,(a:1,b:2)ab:3)root;"},
+		// the root is left with one child, which becomes the root
+		{[]string{"c", "d"}, "(a:1,b:2)ab;"},
+	}
+
+	for _, test := range tests {
+		tr, err := newick.NewParser(strings.NewReader("((a:1,b:2)ab:3,(c:4,d:5)cd:6)root;")).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tr.UpdateTipIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		states := make([][]byte, len(tr.Nodes()))
+		for _, n := range tr.Nodes() {
+			states[n.Id()] = []byte{byte(n.Id())}
+		}
+
+		pruned, newStates, err := PruneTips(tr, states, test.prune)
+		if err != nil {
+			t.Error(err)
+		}
+		if pruned.Newick() != test.desiredResult || len(newStates) != len(pruned.Nodes()) {
+			t.Errorf("error in Test_PruneTips")
+		}
+		// the nodes are numbered in preorder, from the root
+		if pruned.Root().Id() != 0 {
+			t.Errorf("error in Test_PruneTips")
+		}
+		// the tips keep their states, and the internal nodes have none
+		for _, n := range pruned.Nodes() {
+			desiredState := []byte{0}
+			if n.Tip() {
+				id, _ := tr.TipId(n.Name())
+				desiredState = states[id]
+			}
+			if !reflect.DeepEqual(newStates[n.Id()], desiredState) {
+				t.Errorf("error in Test_PruneTips")
+			}
+		}
+	}
+
+	tr, err := newick.NewParser(strings.NewReader("((a,b),c);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = PruneTips(tr, [][]byte{{}, {}, {}, {}, {}}, []string{"a", "b"})
+	if err == nil {
+		t.Errorf("error in Test_PruneTips")
+	}
+}
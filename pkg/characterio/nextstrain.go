@@ -0,0 +1,333 @@
+package characterio
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/ash/pkg/bitsets"
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+// NodeData is what we use from a Nextstrain build (an Auspice JSON, or augur node-data JSONs for a newick tree): the
+// categorical traits of each node, the nucleotide mutations on the branch above each node, and the root's sequence
+type NodeData struct {
+	Traits       map[string]map[string]string // node name -> trait -> value
+	Mutations    map[string][]string          // node name -> nucleotide mutations, e.g. A241G
+	RootSequence string
+}
+
+func newNodeData() NodeData {
+	return NodeData{Traits: make(map[string]map[string]string), Mutations: make(map[string][]string)}
+}
+
+func (data NodeData) addTrait(node, trait, value string) {
+	if _, ok := data.Traits[node]; !ok {
+		data.Traits[node] = make(map[string]string)
+	}
+	data.Traits[node][trait] = value
+}
+
+// ReadAuspice reads the tree in an Auspice v2 JSON, with its node names, and branch lengths from the nodes' divergence
+// if it has it. Its traits, nucleotide mutations and root sequence are returned as NodeData. The traits are the ones
+// named, or if none are, the colorings the JSON declares categorical. The nodes are numbered in preorder, as the newick
+// parser does
+func ReadAuspice(auspiceFile string, traits []string) (*tree.Tree, NodeData, error) {
+
+	b, err := os.ReadFile(auspiceFile)
+	if err != nil {
+		return new(tree.Tree), NodeData{}, err
+	}
+
+	var aj auspiceJSON
+	err = json.Unmarshal(b, &aj)
+	if err != nil {
+		return new(tree.Tree), NodeData{}, errors.New(auspiceFile + ": " + err.Error())
+	}
+	if aj.Tree == nil {
+		return new(tree.Tree), NodeData{}, errors.New(auspiceFile + ": no tree in the Auspice JSON")
+	}
+
+	data := newNodeData()
+	data.RootSequence = aj.RootSequence["nuc"]
+
+	categorical := make(map[string]bool)
+	for _, c := range aj.Meta.Colorings {
+		if c.Type == "categorical" {
+			categorical[c.Key] = true
+		}
+	}
+
+	t := tree.NewTree()
+	nnodes := 0
+
+	var build func(an *auspiceNode, parent *tree.Node, parentDiv interface{}) error
+	build = func(an *auspiceNode, parent *tree.Node, parentDiv interface{}) error {
+		if len(an.Name) == 0 {
+			return errors.New("a node of the tree has no name")
+		}
+		n := t.NewNode()
+		n.SetName(an.Name)
+		n.SetId(nnodes)
+		nnodes++
+
+		div := an.NodeAttrs["div"]
+		if parent != nil {
+			e := t.ConnectNodes(parent, n)
+			length := tree.NIL_LENGTH
+			if d, ok := div.(float64); ok {
+				if pd, ok := parentDiv.(float64); ok {
+					length = d - pd
+				}
+			}
+			e.SetLength(length)
+		} else {
+			t.SetRoot(n)
+		}
+
+		for trait, attr := range an.NodeAttrs {
+			if !isTrait(trait, traits, categorical) {
+				continue
+			}
+			// categorical traits are {"value": "..."}, but so are e.g. dates, which have numbers
+			if m, ok := attr.(map[string]interface{}); ok {
+				if value, ok := m["value"].(string); ok {
+					data.addTrait(an.Name, trait, value)
+				}
+			}
+		}
+		if an.BranchAttrs != nil {
+			data.Mutations[an.Name] = append(data.Mutations[an.Name], an.BranchAttrs.Mutations["nuc"]...)
+		}
+
+		for _, child := range an.Children {
+			err := build(child, n, div)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err = build(aj.Tree, nil, nil)
+	if err != nil {
+		return new(tree.Tree), NodeData{}, errors.New(auspiceFile + ": " + err.Error())
+	}
+
+	return t, data, nil
+}
+
+// ReadNodeData adds what's in augur node-data JSONs (e.g. from augur ancestral, traits or clades) to data: a node's
+// "muts" are its mutations, the root sequence is the "nuc" reference or the root's "sequence", and its traits are the
+// string attributes that are named, or if none are, the ones with a confidence or an entropy (as augur traits writes)
+func ReadNodeData(t *tree.Tree, nodeDataFiles []string, data NodeData, traits []string) (NodeData, error) {
+
+	if data.Traits == nil {
+		data = newNodeData()
+	}
+	root := NodeNames(t)[t.Root().Id()]
+
+	for _, nodeDataFile := range nodeDataFiles {
+		b, err := os.ReadFile(nodeDataFile)
+		if err != nil {
+			return NodeData{}, err
+		}
+
+		var nd struct {
+			Nodes     map[string]map[string]interface{} `json:"nodes"`
+			Reference map[string]string                 `json:"reference"`
+		}
+		err = json.Unmarshal(b, &nd)
+		if err != nil {
+			return NodeData{}, errors.New(nodeDataFile + ": " + err.Error())
+		}
+
+		if seq, ok := nd.Reference["nuc"]; ok {
+			data.RootSequence = seq
+		}
+
+		inferred := make(map[string]bool)
+		for _, attrs := range nd.Nodes {
+			for key := range attrs {
+				if strings.HasSuffix(key, "_confidence") {
+					inferred[strings.TrimSuffix(key, "_confidence")] = true
+				} else if strings.HasSuffix(key, "_entropy") {
+					inferred[strings.TrimSuffix(key, "_entropy")] = true
+				}
+			}
+		}
+
+		for node, attrs := range nd.Nodes {
+			for key, attr := range attrs {
+				switch key {
+				case "muts":
+					muts, ok := attr.([]interface{})
+					if !ok {
+						return NodeData{}, errors.New(nodeDataFile + ": badly formatted mutations for " + node)
+					}
+					for _, m := range muts {
+						if s, ok := m.(string); ok {
+							data.Mutations[node] = append(data.Mutations[node], s)
+						}
+					}
+				case "sequence":
+					if s, ok := attr.(string); ok && node == root && len(data.RootSequence) == 0 {
+						data.RootSequence = s
+					}
+				default:
+					if value, ok := attr.(string); ok && isTrait(key, traits, inferred) {
+						data.addTrait(node, key, value)
+					}
+				}
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// whether a node attribute is a trait: one of those named, or if none are, one of the defaults
+func isTrait(key string, traits []string, defaults map[string]bool) bool {
+	if len(traits) > 0 {
+		return stringInArray(key, traits)
+	}
+	return defaults[key]
+}
+
+// TypeTraits types the traits of the tips, as if they were the columns of a tipfile. If traits is empty, every trait
+// that any tip has is used. Internal nodes' traits aren't used - we reconstruct them
+func TypeTraits(t *tree.Tree, data NodeData, traits []string) ([]CharacterStruct, []StartStop, [][]byte, error) {
+
+	tips := t.Tips()
+
+	if len(traits) == 0 {
+		for _, tip := range tips {
+			for trait := range data.Traits[tip.Name()] {
+				if !stringInArray(trait, traits) {
+					traits = append(traits, trait)
+				}
+			}
+		}
+		sort.Strings(traits)
+	}
+	if len(traits) == 0 {
+		return []CharacterStruct{}, []StartStop{}, [][]byte{}, errors.New("the tips of the tree have no traits (name the ones to reconstruct with --traits)")
+	}
+
+	characterStates := make([]CharacterStruct, len(traits))
+	for i, trait := range traits {
+		characterStates[i] = CharacterStruct{Name: trait, StateKey: make([]string, 0)}
+		for _, tip := range tips {
+			if value, ok := data.Traits[tip.Name()][trait]; ok && len(value) > 0 && !stringInArray(value, characterStates[i].StateKey) {
+				characterStates[i].StateKey = append(characterStates[i].StateKey, value)
+			}
+		}
+		if len(characterStates[i].StateKey) == 0 {
+			return []CharacterStruct{}, []StartStop{}, [][]byte{}, errors.New("no tip has the trait " + trait)
+		}
+		sort.Strings(characterStates[i].StateKey)
+	}
+
+	idx, length := getIndex(characterStates)
+
+	states := make([][]byte, len(t.Nodes()))
+	for i := range states {
+		states[i] = make([]byte, length)
+	}
+
+	for _, tip := range tips {
+		for i, trait := range traits {
+			value, ok := data.Traits[tip.Name()][trait]
+			if !ok || len(value) == 0 {
+				continue
+			}
+			bit, err := stringIndexInArray(value, characterStates[i].StateKey)
+			if err != nil {
+				return []CharacterStruct{}, []StartStop{}, [][]byte{}, err
+			}
+			bitsets.SetBit(states[tip.Id()][idx[i].Start:idx[i].Stop], bit)
+		}
+	}
+
+	return characterStates, idx, states, nil
+}
+
+// TypeMutations gets the tips' states at every site by applying the mutations on the path from the root to each tip
+// to the root's sequence (reference). Sites that mutate to a gap or N are missing data, and IUPAC codes are ambiguous
+func TypeMutations(t *tree.Tree, data NodeData, reference []byte) ([]CharacterStruct, []StartStop, [][]byte, error) {
+
+	if len(reference) == 0 {
+		return []CharacterStruct{}, []StartStop{}, [][]byte{}, errors.New("need the root's sequence to get the tips' states from the tree's mutations")
+	}
+
+	lookup := makeNucByteLookup()
+	current := make([]byte, len(reference))
+	for i, nuc := range bytes.ToUpper(reference) {
+		current[i] = lookup[nuc]
+	}
+
+	names := NodeNames(t)
+	states := make([][]byte, len(t.Nodes()))
+
+	var walk func(cur, prev *tree.Node) error
+	walk = func(cur, prev *tree.Node) error {
+
+		changed := make([]int, 0)
+		old := make([]byte, 0)
+		for _, m := range data.Mutations[names[cur.Id()]] {
+			if len(m) < 3 {
+				return errors.New("badly formatted mutation on " + names[cur.Id()] + ": " + m)
+			}
+			pos, err := strconv.Atoi(m[1 : len(m)-1])
+			if err != nil || pos < 1 || pos > len(current) {
+				return errors.New("badly formatted mutation on " + names[cur.Id()] + ": " + m)
+			}
+			pos--
+			changed = append(changed, pos)
+			old = append(old, current[pos])
+			// gaps and Ns are missing data
+			current[pos] = lookup[bytes.ToUpper([]byte{m[len(m)-1]})[0]]
+		}
+
+		if cur.Tip() && prev != nil {
+			states[cur.Id()] = make([]byte, len(current))
+			copy(states[cur.Id()], current)
+		}
+
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				err := walk(n, cur)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for i := len(changed) - 1; i >= 0; i-- {
+			current[changed[i]] = old[i]
+		}
+
+		return nil
+	}
+	err := walk(t.Root(), nil)
+	if err != nil {
+		return []CharacterStruct{}, []StartStop{}, [][]byte{}, err
+	}
+
+	fillEmptyStates(states, len(reference))
+
+	characterStates := make([]CharacterStruct, len(reference))
+	for i := range characterStates {
+		characterStates[i].V = variant{vtype: "nuc", vpos: i + 1}
+		characterStates[i].Name, _ = getVariantName(characterStates[i].V)
+		characterStates[i].StateKey = nucStateKey
+	}
+
+	idx, _ := getIndex(characterStates)
+
+	return characterStates, idx, states, nil
+}
@@ -0,0 +1,150 @@
+package characterio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+func writeTestFile(t *testing.T, name string, contents string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(filename, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func Test_ReadAuspice(t *testing.T) {
+	// host is a categorical coloring, num_date a continuous one, and region isn't a coloring
+	auspiceFile := writeTestFile(t, "tree.json", `{
+  "version": "v2",
+  "meta": {"colorings": [{"key": "host", "type": "categorical"}, {"key": "num_date", "type": "continuous"}]},
+  "tree": {
+    "name": "NODE_0000000", "node_attrs": {"div": 0},
+    "children": [
+      {"name": "a", "node_attrs": {"div": 1, "host": {"value": "bat"}, "region": {"value": "asia"}, "num_date": {"value": 2020.1}},
+       "branch_attrs": {"mutations": {"nuc": ["A1G"], "S": ["D614G"]}}},
+      {"name": "b", "node_attrs": {"div": 3, "host": {"value": "human"}, "region": {"value": "europe"}}}
+    ]
+  },
+  "root_sequence": {"nuc": "ACGT"}
+}`)
+
+	tests := []struct {
+		traits        []string
+		desiredResult map[string]map[string]string
+	}{
+		{[]string{}, map[string]map[string]string{"a": {"host": "bat"}, "b": {"host": "human"}}},
+		{[]string{"region"}, map[string]map[string]string{"a": {"region": "asia"}, "b": {"region": "europe"}}},
+	}
+
+	for _, test := range tests {
+		tr, data, err := ReadAuspice(auspiceFile, test.traits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data.Traits, test.desiredResult) {
+			t.Errorf("error in Test_ReadAuspice")
+		}
+		if data.RootSequence != "ACGT" || !reflect.DeepEqual(data.Mutations["a"], []string{"A1G"}) {
+			t.Errorf("error in Test_ReadAuspice")
+		}
+		if tr.Newick() != "(a:1,b:3)NODE_0000000;" {
+			t.Errorf("error in Test_ReadAuspice")
+		}
+	}
+}
+
+func Test_ReadNodeData(t *testing.T) {
+	// augur traits writes host with its confidence and entropy. clade_membership (from augur clades) and strain
+	// aren't inferred
+	traitsFile := writeTestFile(t, "traits.json", `{"nodes": {
+  "a": {"host": "bat", "host_confidence": {"bat": 1.0}, "host_entropy": 0.0, "clade_membership": "A", "strain": "a"},
+  "b": {"host": "human", "host_confidence": {"human": 0.9, "bat": 0.1}, "clade_membership": "B", "strain": "b"}
+}}`)
+	mutsFile := writeTestFile(t, "nt_muts.json", `{"nodes": {
+  "NODE_0000000": {"muts": [], "sequence": "ACGT"},
+  "a": {"muts": ["A1G", "C2T"]}
+}}`)
+
+	tr, err := newick.NewParser(strings.NewReader("(a,b);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		traits        []string
+		desiredResult map[string]map[string]string
+	}{
+		{[]string{}, map[string]map[string]string{"a": {"host": "bat"}, "b": {"host": "human"}}},
+		{[]string{"clade_membership", "strain"}, map[string]map[string]string{"a": {"clade_membership": "A", "strain": "a"}, "b": {"clade_membership": "B", "strain": "b"}}},
+	}
+
+	for _, test := range tests {
+		data, err := ReadNodeData(tr, []string{traitsFile, mutsFile}, NodeData{}, test.traits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data.Traits, test.desiredResult) {
+			t.Errorf("error in Test_ReadNodeData")
+		}
+		if data.RootSequence != "ACGT" || !reflect.DeepEqual(data.Mutations["a"], []string{"A1G", "C2T"}) {
+			t.Errorf("error in Test_ReadNodeData")
+		}
+	}
+
+	// no traits at all, unless they're named
+	data, err := ReadNodeData(tr, []string{mutsFile}, NodeData{}, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = TypeTraits(tr, data, []string{})
+	if err == nil {
+		t.Errorf("error in Test_ReadNodeData")
+	}
+}
+
+func Test_TypeMutations(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a,b)x,c);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mutations     map[string][]string
+		desiredResult map[string]string // the tips' sequences, or nil for an error
+	}{
+		{map[string][]string{"x": {"A1G"}, "a": {"C2T"}, "c": {"T4A"}},
+			map[string]string{"a": "GTGT", "b": "GCGT", "c": "ACGA"}},
+		// gaps and Ns are missing data (written as N), and IUPAC codes ambiguous
+		{map[string][]string{"a": {"C2-", "G3N"}, "b": {"A1r"}},
+			map[string]string{"a": "ANNT", "b": "RCGT", "c": "ACGT"}},
+		{map[string][]string{"a": {"C5T"}}, nil},
+		{map[string][]string{"a": {"CT"}}, nil},
+	}
+
+	for _, test := range tests {
+		characters, _, states, err := TypeMutations(tr, NodeData{Mutations: test.mutations}, []byte("acgt"))
+		if test.desiredResult == nil {
+			if err == nil {
+				t.Errorf("error in Test_TypeMutations")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sequences := make(map[string]string)
+		for _, tip := range tr.Tips() {
+			sequences[tip.Name()] = sequenceAt(characters, states, tip.Id(), 0, len(characters))
+		}
+		if !reflect.DeepEqual(sequences, test.desiredResult) {
+			t.Errorf("error in Test_TypeMutations")
+		}
+	}
+}
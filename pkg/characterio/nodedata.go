@@ -0,0 +1,79 @@
+package characterio
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+type nodeDataJSON struct {
+	GeneratedBy map[string]string            `json:"generated_by"`
+	Annotations map[string]auspiceAnnotation `json:"annotations"`
+	Reference   map[string]string            `json:"reference"`
+	Nodes       map[string]nodeDataNode      `json:"nodes"`
+}
+
+type nodeDataNode struct {
+	Muts     []string            `json:"muts"`
+	AAMuts   map[string][]string `json:"aa_muts"`
+	Sequence string              `json:"sequence,omitempty"` // only for the root
+}
+
+// WriteNodeData writes the reconstruction as an augur node-data JSON, i.e. what augur ancestral and augur translate
+// write, for augur export: the nucleotide mutations on the branch above every node, the amino acid changes in each
+// CDS (or mature peptide), the root's sequence (with IUPAC codes for ambiguous sites) and the genome annotation. The
+// characters must be the sites of the (concatenated) alignment. Nodes are named as by NodeNames
+func WriteNodeData(filename string, t *tree.Tree, characters []CharacterStruct, states [][]byte, idx []StartStop, regions []annotation.Region) error {
+
+	names := NodeNames(t)
+	mutations := branchMutations(GetTransitions(t, characters, states, idx, regions), regions)
+	annotations := genomeAnnotations(regions)
+
+	root := sequenceAt(characters, states, t.Root().Id(), 0, len(characters))
+
+	data := nodeDataJSON{
+		GeneratedBy: map[string]string{"program": "ash"},
+		Annotations: annotations,
+		Reference:   map[string]string{"nuc": root},
+		Nodes:       make(map[string]nodeDataNode),
+	}
+
+	for _, n := range t.Nodes() {
+		m := mutations[n.Id()]
+		node := nodeDataNode{Muts: m["nuc"], AAMuts: make(map[string][]string)}
+		if node.Muts == nil {
+			node.Muts = []string{}
+		}
+		// augur translate lists every gene for every node, with or without changes
+		for gene := range annotations {
+			if gene == "nuc" {
+				continue
+			}
+			node.AAMuts[gene] = m[gene]
+			if node.AAMuts[gene] == nil {
+				node.AAMuts[gene] = []string{}
+			}
+		}
+		if n == t.Root() {
+			node.Sequence = root
+		}
+		data.Nodes[names[n.Id()]] = node
+	}
+
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+
+	return err
+}
@@ -0,0 +1,99 @@
+package characterio
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+func Test_NodeNames(t *testing.T) {
+	tests := []struct {
+		nwk           string
+		desiredResult []string // by id (preorder)
+	}{
+		{"((a,b),c);", []string{"NODE_0000000", "NODE_0000001", "a", "b", "c"}},
+		// named internal nodes keep their names, and aren't counted
+		{"((a,b)x,(c,d));", []string{"NODE_0000000", "x", "a", "b", "NODE_0000001", "c", "d"}},
+		{"((a,b)x,c)root;", []string{"root", "x", "a", "b", "c"}},
+	}
+
+	for _, test := range tests {
+		tr, err := newick.NewParser(strings.NewReader(test.nwk)).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the names don't depend on the order the nodes end up in
+		tr.MaxDepthRooted(tr.Root(), nil)
+		tr.SortNeighborsByDepth(tr.Root(), nil)
+		if !reflect.DeepEqual(NodeNames(tr), test.desiredResult) {
+			t.Errorf("error in Test_NodeNames")
+		}
+	}
+}
+
+func Test_WriteNodeData(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a:1,b:1):1,c:1);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions, err := annotation.GetRegions("testdata/typing.gb", "", false, 1, false, annotation.DefaultCDSNaming)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the states of the root, the internal node, then a, b and c. b has a synonymous change in G1, and c a
+	// nonsynonymous change in G2, which is on the minus strand
+	reference := "ATGGAACGTTAACCCTTAAAATTTCATGGG"
+	sequences := []string{reference, reference, reference, "ATGGAGCGTTAACCCTTAAAATTTCATGGG", "ATGGAACGTTAACCCTTAAAATCTCATGGG"}
+	lookup := makeNucByteLookup()
+	states := make([][]byte, len(sequences))
+	for i, seq := range sequences {
+		for _, nuc := range []byte(seq) {
+			states[i] = append(states[i], lookup[nuc])
+		}
+	}
+	characters := make([]CharacterStruct, len(reference))
+	for i := range characters {
+		characters[i] = CharacterStruct{Name: "nuc:" + strconv.Itoa(i+1), V: variant{vtype: "nuc", vpos: i + 1}, StateKey: nucStateKey}
+	}
+	idx, _ := getIndex(characters)
+
+	nodeDataFile := filepath.Join(t.TempDir(), "nt_muts.json")
+	err = WriteNodeData(nodeDataFile, tr, characters, states, idx, regions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(nodeDataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data nodeDataJSON
+	err = json.Unmarshal(b, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data.Reference["nuc"] != reference || data.Annotations["G2"] != (auspiceAnnotation{Start: 16, End: 27, Strand: "-", Type: "CDS"}) {
+		t.Errorf("error in Test_WriteNodeData")
+	}
+
+	noChanges := map[string][]string{"G1": {}, "G2": {}}
+	desiredResult := map[string]nodeDataNode{
+		"NODE_0000000": {Muts: []string{}, AAMuts: noChanges, Sequence: reference},
+		"NODE_0000001": {Muts: []string{}, AAMuts: noChanges},
+		"a":            {Muts: []string{}, AAMuts: noChanges},
+		"b":            {Muts: []string{"A6G"}, AAMuts: noChanges},
+		"c":            {Muts: []string{"T23C"}, AAMuts: map[string][]string{"G1": {}, "G2": {"K2R"}}},
+	}
+	if !reflect.DeepEqual(data.Nodes, desiredResult) {
+		t.Errorf("error in Test_WriteNodeData")
+	}
+}
@@ -0,0 +1,93 @@
+package characterio
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+// WriteNodeStates writes the states of every character at every node as TSV, in preorder. Each node has its name (as by
+// NodeNames), id, parent, whether it's a tip, and how many tips are below it. The states of a character are joined by
+// "|", and are empty for missing data. In the wide format there is one row per node, with a column per character, and
+// in the long format there is one row per node and character
+func WriteNodeStates(filename string, format string, t *tree.Tree, characters []CharacterStruct, states [][]byte, idx []StartStop) error {
+
+	if format != "wide" && format != "long" {
+		return errors.New("unknown node states format: choose one of wide or long")
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+
+	header := []string{"node", "id", "parent", "tip", "descendant_tips"}
+	if format == "wide" {
+		for _, c := range characters {
+			header = append(header, c.Name)
+		}
+	} else {
+		header = append(header, "character", "state")
+	}
+	_, err = w.WriteString(strings.Join(header, "\t") + "\n")
+	if err != nil {
+		return err
+	}
+
+	names := NodeNames(t)
+	tipCounts := make(map[int]int)
+	CountTips(t.Root(), nil, tipCounts)
+
+	var walk func(cur, prev *tree.Node) error
+	walk = func(cur, prev *tree.Node) error {
+		id := cur.Id()
+		parent := ""
+		if prev != nil {
+			parent = names[prev.Id()]
+		}
+		node := []string{names[id], strconv.Itoa(id), parent, strconv.FormatBool(cur.Tip() && prev != nil), strconv.Itoa(tipCounts[id])}
+
+		rows := make([][]string, 0)
+		if format == "wide" {
+			row := node
+			for i := range idx {
+				row = append(row, strings.Join(stateNames(states[id][idx[i].Start:idx[i].Stop], characters[i]), "|"))
+			}
+			rows = append(rows, row)
+		} else {
+			for i := range idx {
+				row := append(append([]string{}, node...), characters[i].Name, strings.Join(stateNames(states[id][idx[i].Start:idx[i].Stop], characters[i]), "|"))
+				rows = append(rows, row)
+			}
+		}
+		for _, row := range rows {
+			_, err := w.WriteString(strings.Join(row, "\t") + "\n")
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				err := walk(n, cur)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err = walk(t.Root(), nil)
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,66 @@
+package characterio
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+func Test_WriteNodeStates(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a,b),c);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the states of the root, the internal node, then a, b and c. b is missing the host, and the internal node is
+	// ambiguous
+	characters := []CharacterStruct{{Name: "host", StateKey: []string{"bat", "human"}}, {Name: "nuc:1", StateKey: []string{"A", "C", "G", "T"}}}
+	idx := []StartStop{{Start: 0, Stop: 1}, {Start: 1, Stop: 2}}
+	states := [][]byte{{128, 128}, {192, 128}, {128, 128}, {0, 32}, {64, 128}}
+
+	tests := []struct {
+		format        string
+		desiredResult string
+	}{
+		{"wide", "node\tid\tparent\ttip\tdescendant_tips\thost\tnuc:1\n" +
+			"NODE_0000000\t0\t\tfalse\t3\tbat\tA\n" +
+			"NODE_0000001\t1\tNODE_0000000\tfalse\t2\tbat|human\tA\n" +
+			"a\t2\tNODE_0000001\ttrue\t1\tbat\tA\n" +
+			"b\t3\tNODE_0000001\ttrue\t1\t\tG\n" +
+			"c\t4\tNODE_0000000\ttrue\t1\thuman\tA\n"},
+		{"long", "node\tid\tparent\ttip\tdescendant_tips\tcharacter\tstate\n" +
+			"NODE_0000000\t0\t\tfalse\t3\thost\tbat\n" +
+			"NODE_0000000\t0\t\tfalse\t3\tnuc:1\tA\n" +
+			"NODE_0000001\t1\tNODE_0000000\tfalse\t2\thost\tbat|human\n" +
+			"NODE_0000001\t1\tNODE_0000000\tfalse\t2\tnuc:1\tA\n" +
+			"a\t2\tNODE_0000001\ttrue\t1\thost\tbat\n" +
+			"a\t2\tNODE_0000001\ttrue\t1\tnuc:1\tA\n" +
+			"b\t3\tNODE_0000001\ttrue\t1\thost\t\n" +
+			"b\t3\tNODE_0000001\ttrue\t1\tnuc:1\tG\n" +
+			"c\t4\tNODE_0000000\ttrue\t1\thost\thuman\n" +
+			"c\t4\tNODE_0000000\ttrue\t1\tnuc:1\tA\n"},
+	}
+
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), "states.tsv")
+		err = WriteNodeStates(filename, test.format, tr, characters, states, idx)
+		if err != nil {
+			t.Error(err)
+		}
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.desiredResult {
+			t.Errorf("error in Test_WriteNodeStates")
+		}
+	}
+
+	err = WriteNodeStates(filepath.Join(t.TempDir(), "states.tsv"), "tall", tr, characters, states, idx)
+	if err == nil {
+		t.Errorf("error in Test_WriteNodeStates")
+	}
+}
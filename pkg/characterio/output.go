@@ -1,6 +1,10 @@
 package characterio
 
 import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -176,38 +180,102 @@ func updateMap(m map[string]int, cur, prev *tree.Node, states [][]byte, idx Star
 // 	return m
 // }
 
-// func WriteChildren(filename string, cS []characterio.CharacterStruct, m map[string]map[string][]tree.TipBag) error {
+// TipMetadata is a table of information about the tips, to join to the outputs by tip name
+type TipMetadata struct {
+	Columns []string            // the names of the columns, not including the tip name
+	Rows    map[string][]string // tip name -> the values in the columns
+}
 
-// 	f, err := os.Create(filename)
-// 	if err != nil {
-// 		return err
-// 	}
+// ReadTipMetadata reads a CSV (or TSV, if its name ends in .tsv) with a header, whose first column is the tip names
+func ReadTipMetadata(filename string) (TipMetadata, error) {
 
-// 	_, err = f.WriteString("character,transition,child,state\n")
-// 	if err != nil {
-// 		return err
-// 	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return TipMetadata{}, err
+	}
+	defer f.Close()
 
-// 	var genotype string
+	r := csv.NewReader(f)
+	if strings.ToLower(filepath.Ext(filename)) == ".tsv" {
+		r.Comma = '\t'
+		r.LazyQuotes = true
+	}
 
-// 	for _, c := range cS {
-// 		char := c.Name
-// 		for transition := range m[c.Name] {
-// 			for i, tb := range m[c.Name][transition] {
-// 				tipNames := tb.TipNames()
-// 				for _, tip := range tipNames {
-// 					genotype = c.Tipmap[tip]
-// 					if genotype == "" {
-// 						genotype = "missing"
-// 					}
-// 					_, err = f.WriteString(char + "," + transition + "#" + strconv.Itoa(i) + "," + tip + "," + genotype + "\n")
-// 					if err != nil {
-// 						return err
-// 					}
-// 				}
-// 			}
-// 		}
-// 	}
+	records, err := r.ReadAll()
+	if err != nil {
+		return TipMetadata{}, errors.New(filename + ": " + err.Error())
+	}
+	if len(records) == 0 || len(records[0]) < 2 {
+		return TipMetadata{}, errors.New("badly formatted metadata: fewer than two columns in " + filename)
+	}
 
-// 	return nil
-// }
+	md := TipMetadata{Columns: records[0][1:], Rows: make(map[string][]string)}
+	for _, record := range records[1:] {
+		md.Rows[record[0]] = record[1:]
+	}
+
+	return md, nil
+}
+
+// WriteChildren writes the tips below each transition (that has more than threshold of them) and their states at its
+// character as CSV, one row per tip, with the metadata columns for each tip (empty if it isn't in the metadata)
+func WriteChildren(filename string, threshold int, transitions [][]Transition, characters []CharacterStruct, states [][]byte, idx []StartStop, metadata TipMetadata) error {
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+
+	err = w.Write(append([]string{"character", "transition", "child", "state"}, metadata.Columns...))
+	if err != nil {
+		return err
+	}
+
+	empty := make([]string, len(metadata.Columns))
+
+	for i := range transitions {
+		for _, trans := range transitions[i] {
+			tips := make([]*tree.Node, 0)
+			childTips(trans.Downnode, trans.Upnode, &tips)
+			if !(len(tips) > threshold) {
+				continue
+			}
+			for _, tip := range tips {
+				state := strings.Join(stateNames(states[tip.Id()][idx[i].Start:idx[i].Stop], characters[i]), "|")
+				if len(state) == 0 {
+					state = "missing"
+				}
+				row := []string{characters[i].Name, strings.Split(trans.Label, ",")[1], tip.Name(), state}
+				if md, ok := metadata.Rows[tip.Name()]; ok {
+					row = append(row, md...)
+				} else {
+					row = append(row, empty...)
+				}
+				err = w.Write(row)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
+
+// get the tips below cur
+func childTips(cur, prev *tree.Node, tips *[]*tree.Node) {
+	if cur.Tip() {
+		*tips = append(*tips, cur)
+		return
+	}
+	for _, n := range cur.Neigh() {
+		if n != prev {
+			childTips(n, cur, tips)
+		}
+	}
+}
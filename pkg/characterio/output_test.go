@@ -0,0 +1,99 @@
+package characterio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/gotree/newick"
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+func Test_ReadTipMetadata(t *testing.T) {
+	tests := []struct {
+		filename      string
+		contents      string
+		desiredResult TipMetadata
+	}{
+		{"metadata.csv", "strain,date,country\na,2020-01-01,UK\nb,2020-02-01,\"Korea, South\"\n",
+			TipMetadata{Columns: []string{"date", "country"}, Rows: map[string][]string{"a": {"2020-01-01", "UK"}, "b": {"2020-02-01", "Korea, South"}}}},
+		{"metadata.tsv", "strain\tdate\na\t2020-01-01\n",
+			TipMetadata{Columns: []string{"date"}, Rows: map[string][]string{"a": {"2020-01-01"}}}},
+	}
+
+	for _, test := range tests {
+		filename := writeTestFile(t, test.filename, test.contents)
+		md, err := ReadTipMetadata(filename)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(md, test.desiredResult) {
+			t.Errorf("error in Test_ReadTipMetadata")
+		}
+	}
+
+	// no columns but the tip names
+	_, err := ReadTipMetadata(writeTestFile(t, "metadata.csv", "strain\na\n"))
+	if err == nil {
+		t.Errorf("error in Test_ReadTipMetadata")
+	}
+}
+
+func Test_WriteChildren(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a,b),c);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := make(map[int]*tree.Node)
+	for _, n := range tr.Nodes() {
+		nodes[n.Id()] = n
+	}
+
+	// the states of the root, the internal node, then a, b and c. b is missing the host
+	characters := []CharacterStruct{{Name: "host", StateKey: []string{"bat", "human"}}}
+	idx := []StartStop{{Start: 0, Stop: 1}}
+	states := [][]byte{{128}, {64}, {64}, {0}, {64}}
+
+	// bat->human on the branch to the internal node, and to c
+	transitions := [][]Transition{{
+		{Upnode: nodes[0], Downnode: nodes[1], Upstate: "bat", Downstate: "human", Number: 1, Transition: "bat->human", Label: "host=bat->human,bat->human#1"},
+		{Upnode: nodes[0], Downnode: nodes[4], Upstate: "bat", Downstate: "human", Number: 2, Transition: "bat->human", Label: "host=bat->human,bat->human#2"},
+	}}
+	metadata := TipMetadata{Columns: []string{"date", "country"}, Rows: map[string][]string{"a": {"2020-01-01", "UK"}, "c": {"2020-03-01", "Korea, South"}}}
+
+	tests := []struct {
+		threshold     int
+		metadata      TipMetadata
+		desiredResult string
+	}{
+		{0, TipMetadata{}, "character,transition,child,state\n" +
+			"host,bat->human#1,a,human\n" +
+			"host,bat->human#1,b,missing\n" +
+			"host,bat->human#2,c,human\n"},
+		// only transitions with more than threshold children, and tips that aren't in the metadata have empty columns
+		{1, metadata, "character,transition,child,state,date,country\n" +
+			"host,bat->human#1,a,human,2020-01-01,UK\n" +
+			"host,bat->human#1,b,missing,,\n"},
+		{0, metadata, "character,transition,child,state,date,country\n" +
+			"host,bat->human#1,a,human,2020-01-01,UK\n" +
+			"host,bat->human#1,b,missing,,\n" +
+			"host,bat->human#2,c,human,2020-03-01,\"Korea, South\"\n"},
+	}
+
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), "children.csv")
+		err = WriteChildren(filename, test.threshold, transitions, characters, states, idx, test.metadata)
+		if err != nil {
+			t.Error(err)
+		}
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.desiredResult {
+			t.Errorf("error in Test_WriteChildren")
+		}
+	}
+}
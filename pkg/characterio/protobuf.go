@@ -0,0 +1,118 @@
+package characterio
+
+import (
+	"errors"
+	"strconv"
+)
+
+// just enough of the protocol buffers wire format (https://developers.google.com/protocol-buffers/docs/encoding)
+// to read and write UShER mutation-annotated trees, without depending on a protobuf library
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, field int, wireType int) []byte {
+	return appendVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendTag(b, field, wireVarint)
+	return appendVarint(b, v)
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// one field of a protobuf message. Varint fields have their value in varint, length-delimited fields in bytes
+type pbField struct {
+	number   int
+	wireType int
+	varint   uint64
+	bytes    []byte
+}
+
+func readVarint(b []byte, i int) (uint64, int, error) {
+	var v uint64
+	for shift := 0; shift < 64; shift += 7 {
+		if i >= len(b) {
+			return 0, i, errors.New("truncated protobuf varint")
+		}
+		v |= uint64(b[i]&0x7f) << shift
+		i++
+		if b[i-1] < 0x80 {
+			return v, i, nil
+		}
+	}
+	return 0, i, errors.New("badly formatted protobuf varint")
+}
+
+// split a protobuf message into its fields. Fixed-width fields (which UShER doesn't use) are skipped
+func readFields(b []byte) ([]pbField, error) {
+	fields := make([]pbField, 0)
+	for i := 0; i < len(b); {
+		tag, next, err := readVarint(b, i)
+		if err != nil {
+			return []pbField{}, err
+		}
+		i = next
+		f := pbField{number: int(tag >> 3), wireType: int(tag & 7)}
+		switch f.wireType {
+		case wireVarint:
+			f.varint, i, err = readVarint(b, i)
+			if err != nil {
+				return []pbField{}, err
+			}
+		case wireBytes:
+			var l uint64
+			l, i, err = readVarint(b, i)
+			if err != nil {
+				return []pbField{}, err
+			}
+			if uint64(len(b)-i) < l {
+				return []pbField{}, errors.New("truncated protobuf field")
+			}
+			f.bytes = b[i : i+int(l)]
+			i += int(l)
+		case 1: // 64-bit
+			i += 8
+			continue
+		case 5: // 32-bit
+			i += 4
+			continue
+		default:
+			return []pbField{}, errors.New("unknown protobuf wire type: " + strconv.Itoa(f.wireType))
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// the values of a repeated varint field, which may or may not be packed
+func (f pbField) varints() ([]uint64, error) {
+	if f.wireType == wireVarint {
+		return []uint64{f.varint}, nil
+	}
+	values := make([]uint64, 0)
+	for i := 0; i < len(f.bytes); {
+		v, next, err := readVarint(f.bytes, i)
+		if err != nil {
+			return []uint64{}, err
+		}
+		values = append(values, v)
+		i = next
+	}
+	return values, nil
+}
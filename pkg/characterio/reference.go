@@ -0,0 +1,163 @@
+package characterio
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+)
+
+// RefCoords maps between the columns of an alignment that keeps insertions relative to a reference
+// (so the reference row has gaps in it), and the coordinates of the (ungapped) reference
+type RefCoords struct {
+	RefID      string      // the name of the reference row in the alignment
+	ColToRef   []int       // for each 1-based column, the 1-based reference position, or 0 for an insertion column (index 0 is unused)
+	RefToCol   []int       // for each 1-based reference position, the 1-based column (index 0 is unused)
+	Insertions []Insertion // the insertion columns, once the alignment has been typed
+}
+
+// Insertion is one column of the alignment that is a gap in the reference
+type Insertion struct {
+	Column int // 1-based column in the alignment
+	After  int // the 1-based reference position that this insertion follows (0 if it is before the start of the reference)
+	Count  int // how many tips have a base in this column
+}
+
+// read one record from a fasta file (the first one, if ID is empty), in upper case
+func readFastaRecord(alignmentFile string, ID string) (string, error) {
+
+	records, err := annotation.ReadFasta(alignmentFile, func(id string) bool { return id == ID || len(ID) == 0 }, 1)
+	if err != nil {
+		return "", err
+	}
+
+	if len(records) == 0 {
+		return "", errors.New("couldn't find the reference in the alignment: " + ID)
+	}
+
+	return strings.ToUpper(records[0].Seq), nil
+}
+
+// GetRefCoords builds the maps between alignment columns and reference coordinates from the named
+// reference row of an alignment
+func GetRefCoords(alignmentFile string, referenceID string) (*RefCoords, error) {
+
+	refseq, err := readFastaRecord(alignmentFile, referenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := RefCoords{RefID: referenceID, ColToRef: make([]int, len(refseq)+1), RefToCol: []int{0}}
+
+	refpos := 0
+	for i := 0; i < len(refseq); i++ {
+		if refseq[i] == '-' {
+			continue
+		}
+		refpos++
+		rc.ColToRef[i+1] = refpos
+		rc.RefToCol = append(rc.RefToCol, i+1)
+	}
+
+	return &rc, nil
+}
+
+// the length of the reference (without gaps)
+func (rc *RefCoords) refLength() int {
+	return len(rc.RefToCol) - 1
+}
+
+// project a sequence from alignment columns onto reference coordinates, dropping any insertion columns
+func (rc *RefCoords) project(seq string) (string, error) {
+	if len(seq) != len(rc.ColToRef)-1 {
+		return "", errors.New("sequence is not the same length as the reference in the alignment")
+	}
+	b := make([]byte, rc.refLength())
+	for i := 1; i < len(rc.RefToCol); i++ {
+		b[i-1] = seq[rc.RefToCol[i]-1]
+	}
+	return string(b), nil
+}
+
+// project some bit-encoded nucleotide states (one byte per column) onto reference coordinates,
+// and count how many tips have a base at each insertion column as we go
+func (rc *RefCoords) projectStates(states [][]byte) ([][]byte, error) {
+
+	rc.Insertions = make([]Insertion, 0)
+	for col := 1; col < len(rc.ColToRef); col++ {
+		if rc.ColToRef[col] == 0 {
+			rc.Insertions = append(rc.Insertions, Insertion{Column: col, After: rc.ColToRef[col-1]})
+		}
+	}
+	// for insertions after other insertions, we want the preceding reference position
+	for i := range rc.Insertions {
+		if i > 0 && rc.Insertions[i].Column == rc.Insertions[i-1].Column+1 {
+			rc.Insertions[i].After = rc.Insertions[i-1].After
+		}
+	}
+
+	projected := make([][]byte, len(states))
+	for i := range states {
+		if states[i] == nil {
+			continue
+		}
+		if len(states[i]) != len(rc.ColToRef)-1 {
+			return [][]byte{}, errors.New("sequences in the alignment are not the same length as the reference")
+		}
+		projected[i] = make([]byte, rc.refLength())
+		for j := 1; j < len(rc.RefToCol); j++ {
+			projected[i][j-1] = states[i][rc.RefToCol[j]-1]
+		}
+		for k := range rc.Insertions {
+			if states[i][rc.Insertions[k].Column-1] > 0 {
+				rc.Insertions[k].Count++
+			}
+		}
+	}
+
+	return projected, nil
+}
+
+// convert the position of an ins:pos:len character from the reference position that the insertion follows
+// to the first alignment column of the insertion
+func (rc *RefCoords) insertionColumn(v variant) (int, error) {
+	if v.vpos < 0 || v.vpos > rc.refLength() {
+		return 0, errors.New("insertion is out of range of the reference: ins:" + strconv.Itoa(v.vpos))
+	}
+	start := 1
+	if v.vpos > 0 {
+		start = rc.RefToCol[v.vpos] + 1
+	}
+	for col := start; col < start+v.vlength; col++ {
+		if col >= len(rc.ColToRef) || rc.ColToRef[col] != 0 {
+			return 0, errors.New("not an insertion relative to the reference: ins:" + strconv.Itoa(v.vpos) + ":" + strconv.Itoa(v.vlength))
+		}
+	}
+	return start, nil
+}
+
+// WriteInsertions writes a TSV of the insertion columns in an alignment relative to its reference
+func WriteInsertions(filename string, rc *RefCoords) error {
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString("column\tafter_ref_pos\tn_tips_with_base\n")
+	if err != nil {
+		return err
+	}
+
+	for _, ins := range rc.Insertions {
+		_, err = f.WriteString(strconv.Itoa(ins.Column) + "\t" + strconv.Itoa(ins.After) + "\t" + strconv.Itoa(ins.Count) + "\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package characterio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/ash/pkg/bitsets"
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+// testdata/gapped.fasta has two insertion columns (4 and 5) relative to its reference row, which isn't in the tree
+func Test_GetRefCoords(t *testing.T) {
+	coords, err := GetRefCoords("testdata/gapped.fasta", "ref")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(coords.ColToRef, []int{0, 1, 2, 3, 0, 0, 4, 5, 6, 7, 8, 9}) ||
+		!reflect.DeepEqual(coords.RefToCol, []int{0, 1, 2, 3, 6, 7, 8, 9, 10, 11}) {
+		t.Errorf("error in Test_GetRefCoords")
+	}
+
+	_, err = GetRefCoords("testdata/gapped.fasta", "notthere")
+	if err == nil {
+		t.Errorf("error in Test_GetRefCoords")
+	}
+
+	tests := []struct {
+		v             variant
+		desiredResult int // the first column of the insertion, or 0 for an error
+	}{
+		{variant{vtype: "ins", vpos: 3, vlength: 1}, 4},
+		{variant{vtype: "ins", vpos: 3, vlength: 2}, 4},
+		{variant{vtype: "ins", vpos: 3, vlength: 3}, 0},
+		{variant{vtype: "ins", vpos: 4, vlength: 1}, 0},
+		{variant{vtype: "ins", vpos: 10, vlength: 1}, 0},
+	}
+
+	for _, test := range tests {
+		col, err := coords.insertionColumn(test.v)
+		if (err != nil) != (test.desiredResult == 0) || col != test.desiredResult {
+			t.Errorf("error in Test_GetRefCoords")
+		}
+	}
+}
+
+func Test_TypeAlignmentNucRefCoords(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a,b),c);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.UpdateTipIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	coords, err := GetRefCoords("testdata/gapped.fasta", "ref")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	characters, _, states, err := TypeAlignmentNuc(tr, "testdata/gapped.fasta", coords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(characters) != 9 {
+		t.Errorf("error in Test_TypeAlignmentNucRefCoords")
+	}
+
+	// the tips' states are in reference coordinates
+	tests := []struct {
+		tip           string
+		desiredResult []byte
+	}{
+		{"a", []byte{128, 16, 32, 32, 128, 128, 64, 32, 16}},
+		{"b", []byte{128, 16, 32, 32, 128, 32, 64, 32, 16}},
+		{"c", []byte{128, 16, 32, 32, 128, 128, 64, 32, 128}},
+	}
+
+	for _, test := range tests {
+		id, err := tr.TipId(test.tip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(states[id], test.desiredResult) {
+			t.Errorf("error in Test_TypeAlignmentNucRefCoords")
+		}
+	}
+
+	// and the insertion columns are counted, for --insertions-out
+	insertionsFile := filepath.Join(t.TempDir(), "insertions.tsv")
+	err = WriteInsertions(insertionsFile, coords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertions, err := os.ReadFile(insertionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(insertions) != "column\tafter_ref_pos\tn_tips_with_base\n4\t3\t2\n5\t3\t1\n" {
+		t.Errorf("error in Test_TypeAlignmentNucRefCoords")
+	}
+}
+
+func Test_TypeAlignmentRefCoords(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a,b),c);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.UpdateTipIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	coords, err := GetRefCoords("testdata/gapped.fasta", "ref")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nuc:6 is the sixth reference position (column 8), and ins:3:2 the two columns after reference position 3,
+	// which are typed as the inserted bases
+	configFile := filepath.Join(t.TempDir(), "config")
+	err = os.WriteFile(configFile, []byte("nuc:6\nins:3:2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	characters, idx, states, err := TypeAlignment(tr, "testdata/gapped.fasta", configFile, "", "", 1, annotation.DefaultCDSNaming, coords)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := map[string][]string{
+		"a": {"A", "CC"},
+		"b": {"G", "none"},
+		"c": {"A", "C"},
+	}
+
+	for tip, desiredStates := range desiredResult {
+		id, err := tr.TipId(tip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, c := range characters {
+			names := make([]string, 0)
+			for _, bit := range bitsets.GetSetBits(states[id][idx[i].Start:idx[i].Stop]) {
+				names = append(names, c.StateKey[bit-1])
+			}
+			if !reflect.DeepEqual(names, []string{desiredStates[i]}) {
+				t.Errorf("error in Test_TypeAlignmentRefCoords")
+			}
+		}
+	}
+}
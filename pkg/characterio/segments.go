@@ -0,0 +1,114 @@
+package characterio
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+// Segment is one segment (or contig, or chromosome) of a multi-segment genome, which has its
+// own alignment and annotation
+type Segment struct {
+	Name      string // e.g. "HA"
+	Alignment string // fasta format alignment of this segment
+	Genbank   string // genbank (or GFF3) format annotation of this segment
+	Fasta     string // the sequence of this segment, if its annotation is GFF3 without a ##FASTA section
+	Offset    int    // how many sites come before this segment in the concatenated character set
+	Length    int    // how many sites this segment has in the concatenated character set
+}
+
+// ReadSegments reads a CSV file with one line per segment: name,alignment,genbank, with an optional fourth
+// column for the fasta sequence of a GFF3 annotation
+func ReadSegments(segmentsFile string) ([]Segment, error) {
+
+	segments := make([]Segment, 0)
+
+	f, err := os.Open(segmentsFile)
+	if err != nil {
+		return []Segment{}, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 && len(fields) != 4 {
+			return []Segment{}, errors.New("badly formatted segments file (expected name,alignment,genbank[,fasta]): " + line)
+		}
+		for _, seg := range segments {
+			if seg.Name == fields[0] {
+				return []Segment{}, errors.New("duplicate segment name in segments file: " + fields[0])
+			}
+		}
+		segment := Segment{Name: fields[0], Alignment: fields[1], Genbank: fields[2]}
+		if len(fields) == 4 {
+			segment.Fasta = fields[3]
+		}
+		segments = append(segments, segment)
+	}
+
+	err = s.Err()
+	if err != nil {
+		return []Segment{}, err
+	}
+
+	if len(segments) == 0 {
+		return []Segment{}, errors.New("no segments in segments file: " + segmentsFile)
+	}
+
+	return segments, nil
+}
+
+// TypeSegmentsNuc types every site of every segment's alignment, and concatenates them into one character set.
+// The Offset and Length of each segment are set as we go. Tips that are missing from a segment's alignment have
+// missing data for all of that segment's sites.
+// If referenceID isn't empty, each segment's alignment is typed in the coordinates of its row with that name
+func TypeSegmentsNuc(t *tree.Tree, segments []Segment, referenceID string) ([]CharacterStruct, []StartStop, [][]byte, error) {
+
+	characterStates := make([]CharacterStruct, 0)
+	states := make([][]byte, len(t.Nodes()))
+
+	offset := 0
+	for i := range segments {
+
+		var coords *RefCoords
+		var err error
+		if len(referenceID) > 0 {
+			coords, err = GetRefCoords(segments[i].Alignment, referenceID)
+			if err != nil {
+				return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), err
+			}
+		}
+
+		segCharacterStates, _, segStates, err := TypeAlignmentNuc(t, segments[i].Alignment, coords)
+		if err != nil {
+			return make([]CharacterStruct, 0), make([]StartStop, 0), make([][]byte, 0), errors.New(segments[i].Name + ": " + err.Error())
+		}
+
+		segments[i].Offset = offset
+		segments[i].Length = len(segCharacterStates)
+
+		for j := range segCharacterStates {
+			segCharacterStates[j].Name = segments[i].Name + ":nuc:" + strconv.Itoa(segCharacterStates[j].V.vpos)
+		}
+		characterStates = append(characterStates, segCharacterStates...)
+
+		for j := range states {
+			states[j] = append(states[j], segStates[j]...)
+		}
+
+		offset += segments[i].Length
+	}
+
+	idx, _ := getIndex(characterStates)
+
+	return characterStates, idx, states, nil
+}
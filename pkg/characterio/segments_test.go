@@ -0,0 +1,104 @@
+package characterio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+func Test_ReadSegments(t *testing.T) {
+	tests := []struct {
+		contents      string
+		desiredResult []Segment // nil for an error
+	}{
+		{"PB2,pb2.fasta,pb2.gb\nHA,ha.fasta,ha.gb\n\n", []Segment{
+			{Name: "PB2", Alignment: "pb2.fasta", Genbank: "pb2.gb"},
+			{Name: "HA", Alignment: "ha.fasta", Genbank: "ha.gb"},
+		}},
+		{"PB2,pb2.fasta\n", nil},
+		{"HA,ha.fasta,ha.gb\nHA,ha2.fasta,ha2.gb\n", nil},
+		{"\n", nil},
+	}
+
+	for _, test := range tests {
+		segmentsFile := filepath.Join(t.TempDir(), "segments.csv")
+		err := os.WriteFile(segmentsFile, []byte(test.contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		segments, err := ReadSegments(segmentsFile)
+		if test.desiredResult == nil {
+			if err == nil {
+				t.Errorf("error in Test_ReadSegments")
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(segments, test.desiredResult) {
+			t.Errorf("error in Test_ReadSegments")
+		}
+	}
+}
+
+func Test_TypeSegmentsNuc(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a,b),c);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.UpdateTipIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// c isn't in the second segment's alignment
+	segments := []Segment{
+		{Name: "S1", Alignment: "testdata/segment1.fasta"},
+		{Name: "S2", Alignment: "testdata/segment2.fasta"},
+	}
+	characters, idx, states, err := TypeSegmentsNuc(tr, segments, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(characters))
+	for i, c := range characters {
+		names[i] = c.Name
+	}
+	if !reflect.DeepEqual(names, []string{"S1:nuc:1", "S1:nuc:2", "S1:nuc:3", "S1:nuc:4", "S2:nuc:1", "S2:nuc:2"}) || len(idx) != 6 {
+		t.Errorf("error in Test_TypeSegmentsNuc")
+	}
+	if segments[0].Offset != 0 || segments[0].Length != 4 || segments[1].Offset != 4 || segments[1].Length != 2 {
+		t.Errorf("error in Test_TypeSegmentsNuc")
+	}
+
+	tests := []struct {
+		tip           string
+		desiredResult []byte
+	}{
+		{"a", []byte{128, 64, 32, 16, 32, 32}},
+		{"b", []byte{128, 64, 32, 128, 32, 16}},
+		{"c", []byte{128, 64, 32, 16, 0, 0}},
+	}
+
+	for _, test := range tests {
+		id, err := tr.TipId(test.tip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(states[id], test.desiredResult) {
+			t.Errorf("error in Test_TypeSegmentsNuc")
+		}
+	}
+
+	// a segment that can't be read is named in the error
+	_, _, _, err = TypeSegmentsNuc(tr, []Segment{{Name: "S3", Alignment: "testdata/notthere.fasta"}}, "")
+	if err == nil || !strings.HasPrefix(err.Error(), "S3: ") {
+		t.Errorf("error in Test_TypeSegmentsNuc")
+	}
+}
@@ -0,0 +1,268 @@
+package characterio
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/ash/pkg/bitsets"
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+// TransitionRecord is one inferred change on a branch, for exporting as JSON
+type TransitionRecord struct {
+	Character          string        `json:"character"`           // e.g. "nuc:241", "S:D614G" or a tipfile column
+	Segment            string        `json:"segment,omitempty"`   // for multi-segment genomes
+	Position           int           `json:"position,omitempty"`  // 1-based site in its segment, for nucleotide sites
+	Ancestral          string        `json:"ancestral"`           // the state(s) at the parent node, joined by "|"
+	Derived            string        `json:"derived"`             // the state(s) at the child node, joined by "|"
+	AmbiguousAncestral bool          `json:"ambiguous_ancestral"` // the parent node has more than one state
+	AmbiguousDerived   bool          `json:"ambiguous_derived"`   // the child node has more than one state
+	ParentID           int           `json:"parent_id"`           // node ids are as in --annotate-nodes
+	ParentName         string        `json:"parent_name"`         // empty for an unnamed internal node, unless it was named (see NodeNames)
+	ChildID            int           `json:"child_id"`
+	ChildName          string        `json:"child_name"`
+	BranchLength       *float64      `json:"branch_length"`    // null if the tree has no branch lengths
+	Terminal           bool          `json:"terminal"`         // the child node is a tip
+	DescendantTips     int           `json:"descendant_tips"`  // how many tips are below the branch
+	Codons             []CodonChange `json:"codons,omitempty"` // the amino acid context of a nucleotide change, in each CDS that the site is in
+}
+
+// CodonChange is the effect of a nucleotide change on the codon of one CDS it is in
+type CodonChange struct {
+	CDS            string `json:"cds"`
+	Protein        string `json:"protein"` // the mature peptide that the residue is in, if we are numbering by them, otherwise the CDS
+	Residue        int    `json:"residue"`
+	AncestralCodon string `json:"ancestral_codon"`
+	DerivedCodon   string `json:"derived_codon"`
+	AncestralAA    string `json:"ancestral_aa"` // X if it can't be translated unambiguously
+	DerivedAA      string `json:"derived_aa"`
+	Effect         string `json:"effect"` // synonymous, nonsynonymous or unresolved
+}
+
+// a codon that a site is in
+type codonRef struct {
+	region  int // index in the regions
+	residue int // 1-based residue number in the CDS
+}
+
+// GetTransitions gets every change on the tree, in preorder, with the same rules as the labellers: changes to missing data
+// and to ambiguous tips that are consistent with their parent aren't included. If regions isn't empty, the characters must be
+// the sites of the (concatenated) alignment, and changes in CDSs get their amino acid context
+func GetTransitions(t *tree.Tree, characters []CharacterStruct, states [][]byte, idx []StartStop, regions []annotation.Region) []TransitionRecord {
+
+	// the codons that each (0-based) site is in
+	codons := make(map[int][]codonRef)
+	for i, region := range regions {
+		if region.Whichtype != "CDS" {
+			continue
+		}
+		for j, codon := range region.Codons {
+			for _, site := range codon {
+				codons[site-1] = append(codons[site-1], codonRef{region: i, residue: j + 1})
+			}
+		}
+	}
+
+	// which region a site is in, for its segment and coordinates
+	siteRegion := make(map[int]int)
+	for i, region := range regions {
+		for pos := region.Start - 1; pos < region.Stop; pos++ {
+			if _, ok := siteRegion[pos]; !ok {
+				siteRegion[pos] = i
+			}
+		}
+	}
+
+	tipCounts := make(map[int]int)
+	CountTips(t.Root(), nil, tipCounts)
+
+	records := make([]TransitionRecord, 0)
+
+	var walk func(cur, prev *tree.Node)
+	walk = func(cur, prev *tree.Node) {
+		for e, n := range cur.Neigh() {
+			if n == prev {
+				continue
+			}
+			up_id := cur.Id()
+			down_id := n.Id()
+			for i := range idx {
+				start := idx[i].Start
+				stop := idx[i].Stop
+
+				if !bitsets.Different(states[up_id][start:stop], states[down_id][start:stop]) {
+					continue
+				}
+				// we don't care about transitions to missing data:
+				if !bitsets.IsAnyBitSet(states[down_id][start:stop]) {
+					continue
+				}
+				// or to ambiguous tips that are consistent with their parent
+				if n.Tip() && bitsets.IsSubset(states[up_id][start:stop], states[down_id][start:stop]) {
+					continue
+				}
+
+				upstate := stateNames(states[up_id][start:stop], characters[i])
+				downstate := stateNames(states[down_id][start:stop], characters[i])
+
+				record := TransitionRecord{
+					Character:          characters[i].Name,
+					Ancestral:          strings.Join(upstate, "|"),
+					Derived:            strings.Join(downstate, "|"),
+					AmbiguousAncestral: len(upstate) > 1,
+					AmbiguousDerived:   len(downstate) > 1,
+					ParentID:           up_id,
+					ParentName:         cur.Name(),
+					ChildID:            down_id,
+					ChildName:          n.Name(),
+					Terminal:           n.Tip(),
+					DescendantTips:     tipCounts[down_id],
+				}
+				if l := cur.Edges()[e].Length(); l != tree.NIL_LENGTH {
+					record.BranchLength = &l
+				}
+
+				if len(regions) > 0 {
+					if r, ok := siteRegion[i]; ok {
+						record.Segment = regions[r].Segment
+						record.Position = i + 1 - regions[r].Offset
+					}
+					for _, c := range codons[i] {
+						record.Codons = append(record.Codons, codonChange(regions[c.region], c.residue, characters, states, up_id, down_id))
+					}
+				}
+
+				records = append(records, record)
+			}
+			walk(n, cur)
+		}
+	}
+	walk(t.Root(), nil)
+
+	return records
+}
+
+// CountTips counts the tips below every node (by id) into counts, and returns the number below cur
+func CountTips(cur, prev *tree.Node, counts map[int]int) int {
+	if cur.Tip() && prev != nil {
+		counts[cur.Id()] = 1
+		return 1
+	}
+	total := 0
+	for _, n := range cur.Neigh() {
+		if n != prev {
+			total += CountTips(n, cur, counts)
+		}
+	}
+	counts[cur.Id()] = total
+	return total
+}
+
+// the names of the states that are set in a character's bitset
+func stateNames(ba []byte, c CharacterStruct) []string {
+	names := make([]string, 0)
+	for _, b := range bitsets.GetSetBits(ba) {
+		names = append(names, c.StateKey[b-1])
+	}
+	return names
+}
+
+// the codon at three (1-based) sites at one node, in the order of the sites, with IUPAC codes for ambiguous sites and N
+// for missing data
+func codonAt(characters []CharacterStruct, states [][]byte, id int, codon [3]int) string {
+	var sb strings.Builder
+	for _, site := range codon {
+		sb.WriteString(sequenceAt(characters, states, id, site-1, site))
+	}
+	return sb.String()
+}
+
+// the sequence of the (0-based, half-open) sites start to stop at one node, with IUPAC codes for ambiguous sites and N
+// for missing data
+func sequenceAt(characters []CharacterStruct, states [][]byte, id int, start, stop int) string {
+	IUPACMap := annotation.GetIUPACMap()
+	var sb strings.Builder
+	for pos := start; pos < stop; pos++ {
+		nucs := stateNames(states[id][pos:pos+1], characters[pos])
+		// sort them, for translating to the correct ambiguity code
+		sort.Strings(nucs)
+		if nuc, ok := IUPACMap[strings.Join(nucs, "")]; ok && len(nucs) > 0 {
+			sb.WriteString(nuc)
+		} else {
+			sb.WriteString("N")
+		}
+	}
+	return sb.String()
+}
+
+// the effect of the change between two nodes on one codon of a CDS
+func codonChange(region annotation.Region, residue int, characters []CharacterStruct, states [][]byte, up_id, down_id int) CodonChange {
+
+	codon := region.Codons[residue-1]
+	upcodon := codonAt(characters, states, up_id, codon)
+	downcodon := codonAt(characters, states, down_id, codon)
+	// CDSs on the minus strand are read from the complement of their sites
+	if region.Complement {
+		upcodon = annotation.Complement(upcodon)
+		downcodon = annotation.Complement(downcodon)
+	}
+
+	codonDict := annotation.CodonDict(region.TranslTable)
+	upAA, ok := codonDict[upcodon]
+	if !ok {
+		upAA = "X"
+	}
+	downAA, ok := codonDict[downcodon]
+	if !ok {
+		downAA = "X"
+	}
+
+	var effect string
+	switch {
+	case upAA == "X" || downAA == "X":
+		effect = "unresolved"
+	case upAA == downAA:
+		effect = "synonymous"
+	default:
+		effect = "nonsynonymous"
+	}
+
+	protein, number := region.Residue(residue)
+
+	return CodonChange{CDS: region.Name, Protein: protein, Residue: number, AncestralCodon: upcodon, DerivedCodon: downcodon,
+		AncestralAA: upAA, DerivedAA: downAA, Effect: effect}
+}
+
+// WriteTransitions writes the transitions to a file as JSON Lines (one record per line) if its name ends in .jsonl,
+// otherwise as a JSON array
+func WriteTransitions(filename string, records []TransitionRecord) error {
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.ToLower(filepath.Ext(filename)) == ".jsonl" {
+		enc := json.NewEncoder(f)
+		for _, r := range records {
+			err = enc.Encode(r)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+
+	return err
+}
@@ -0,0 +1,126 @@
+package characterio
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+func Test_GetTransitions(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("(a:1,b,c:0.5)root;")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// G1 is ATG GAA (ME), and G2 overlaps it in another frame: GGA (G). G3 is on the minus strand, and its one codon
+	// spans an intron: it is the complement of sites 6, 5 and 2, TTA (L)
+	regions := []annotation.Region{
+		{Whichtype: "CDS", Name: "G1", Start: 1, Stop: 6, Codons: [][3]int{{1, 2, 3}, {4, 5, 6}}, TranslTable: 1},
+		{Whichtype: "CDS", Name: "G2", Start: 3, Stop: 5, Codons: [][3]int{{3, 4, 5}}, TranslTable: 1},
+		{Whichtype: "CDS", Name: "G3", Start: 2, Stop: 6, Codons: [][3]int{{6, 5, 2}}, TranslTable: 1, Complement: true},
+	}
+	characters := make([]CharacterStruct, 6)
+	idx := make([]StartStop, 6)
+	for i := range characters {
+		characters[i] = CharacterStruct{Name: "nuc:" + strconv.Itoa(i+1), StateKey: []string{"A", "C", "G", "T"}}
+		idx[i] = StartStop{Start: i, Stop: i + 1}
+	}
+	states := [][]byte{
+		{128, 16, 32, 32, 128, 128}, // the root: ATGGAA
+		{128, 16, 32, 32, 32, 128},  // a: ATGGGA
+		{128, 16, 32, 32, 128, 32},  // b: ATGGAG
+		{16, 16, 0, 32, 128, 128},   // c: TTNGAA - the change to missing data isn't a transition
+	}
+
+	one := 1.0
+	half := 0.5
+	desiredResult := []TransitionRecord{
+		{Character: "nuc:5", Position: 5, Ancestral: "A", Derived: "G", ParentID: 0, ParentName: "root", ChildID: 1, ChildName: "a",
+			BranchLength: &one, Terminal: true, DescendantTips: 1, Codons: []CodonChange{
+				{CDS: "G1", Protein: "G1", Residue: 2, AncestralCodon: "GAA", DerivedCodon: "GGA", AncestralAA: "E", DerivedAA: "G", Effect: "nonsynonymous"},
+				{CDS: "G2", Protein: "G2", Residue: 1, AncestralCodon: "GGA", DerivedCodon: "GGG", AncestralAA: "G", DerivedAA: "G", Effect: "synonymous"},
+				{CDS: "G3", Protein: "G3", Residue: 1, AncestralCodon: "TTA", DerivedCodon: "TCA", AncestralAA: "L", DerivedAA: "S", Effect: "nonsynonymous"},
+			}},
+		{Character: "nuc:6", Position: 6, Ancestral: "A", Derived: "G", ParentID: 0, ParentName: "root", ChildID: 2, ChildName: "b",
+			Terminal: true, DescendantTips: 1, Codons: []CodonChange{
+				{CDS: "G1", Protein: "G1", Residue: 2, AncestralCodon: "GAA", DerivedCodon: "GAG", AncestralAA: "E", DerivedAA: "E", Effect: "synonymous"},
+				{CDS: "G3", Protein: "G3", Residue: 1, AncestralCodon: "TTA", DerivedCodon: "CTA", AncestralAA: "L", DerivedAA: "L", Effect: "synonymous"},
+			}},
+		{Character: "nuc:1", Position: 1, Ancestral: "A", Derived: "T", ParentID: 0, ParentName: "root", ChildID: 3, ChildName: "c",
+			BranchLength: &half, Terminal: true, DescendantTips: 1, Codons: []CodonChange{
+				{CDS: "G1", Protein: "G1", Residue: 1, AncestralCodon: "ATG", DerivedCodon: "TTN", AncestralAA: "M", DerivedAA: "X", Effect: "unresolved"},
+			}},
+	}
+
+	records := GetTransitions(tr, characters, states, idx, regions)
+	if !reflect.DeepEqual(records, desiredResult) {
+		t.Errorf("error in Test_GetTransitions")
+	}
+
+	// without the annotation, there is no amino acid context
+	records = GetTransitions(tr, characters, states, idx, []annotation.Region{})
+	if len(records) != 3 || records[0].Position != 0 || records[0].Codons != nil {
+		t.Errorf("error in Test_GetTransitions")
+	}
+}
+
+func Test_WriteTransitions(t *testing.T) {
+	one := 1.0
+	records := []TransitionRecord{
+		{Character: "nuc:5", Position: 5, Ancestral: "A", Derived: "G", ParentID: 0, ChildID: 1, ChildName: "a", BranchLength: &one, Terminal: true, DescendantTips: 1},
+		{Character: "S:D614G", Ancestral: "absent", Derived: "present", ParentID: 0, ChildID: 2, DescendantTips: 2},
+	}
+
+	dir := t.TempDir()
+
+	err := WriteTransitions(filepath.Join(dir, "transitions.json"), records)
+	if err != nil {
+		t.Error(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "transitions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON []TransitionRecord
+	err = json.Unmarshal(b, &fromJSON)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(fromJSON, records) {
+		t.Errorf("error in Test_WriteTransitions")
+	}
+	// a missing branch length is null, not left out
+	if !strings.Contains(string(b), `"branch_length": null`) {
+		t.Errorf("error in Test_WriteTransitions")
+	}
+
+	err = WriteTransitions(filepath.Join(dir, "transitions.jsonl"), records)
+	if err != nil {
+		t.Error(err)
+	}
+	b, err = os.ReadFile(filepath.Join(dir, "transitions.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != len(records) {
+		t.Errorf("error in Test_WriteTransitions")
+	}
+	for i, line := range lines {
+		var r TransitionRecord
+		err = json.Unmarshal([]byte(line), &r)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(r, records[i]) {
+			t.Errorf("error in Test_WriteTransitions")
+		}
+	}
+}
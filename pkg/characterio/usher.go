@@ -0,0 +1,356 @@
+package characterio
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/benjamincjackson/ash/pkg/bitsets"
+	"github.com/benjamincjackson/gotree/newick"
+	"github.com/benjamincjackson/gotree/tree"
+)
+
+// UShER encodes nucleotides as 0-3, in the same order as nucStateKey
+var usherNucs = map[byte]int{'A': 0, 'C': 1, 'G': 2, 'T': 3}
+
+// one mutation on a branch of a mutation-annotated tree
+type matMutation struct {
+	position   int // 1-based, in its chromosome (segment)
+	refNuc     int
+	parNuc     int
+	mutNuc     int
+	chromosome string
+}
+
+func (m matMutation) encode() []byte {
+	b := make([]byte, 0, 16)
+	b = appendVarintField(b, 1, uint64(m.position))
+	b = appendVarintField(b, 2, uint64(m.refNuc))
+	b = appendVarintField(b, 3, uint64(m.parNuc))
+	b = appendBytesField(b, 4, appendVarint(nil, uint64(m.mutNuc))) // mut_nuc is a packed repeated field
+	if len(m.chromosome) > 0 {
+		b = appendBytesField(b, 5, []byte(m.chromosome))
+	}
+	return b
+}
+
+// WriteMAT writes the tree and the nucleotide mutations on its branches as an UShER mutation-annotated tree (protobuf).
+// The characters must be the sites of the (concatenated) alignment, and references the sequence of each segment (or
+// for a single genome, of the whole thing, with segments empty). A node's state at a site is its inferred nucleotide,
+// or its parent's if that is ambiguous or missing, so the mutations from the root to a node always give its sequence.
+// The root's mutations are its differences from the reference. Branch lengths are the number of mutations, as in UShER
+func WriteMAT(filename string, t *tree.Tree, states [][]byte, segments []Segment, references [][]byte) error {
+
+	if len(segments) == 0 {
+		l := 0
+		if len(states) > 0 {
+			l = len(states[0])
+		}
+		segments = []Segment{{Name: "", Offset: 0, Length: l}}
+	}
+	if len(references) != len(segments) {
+		return errors.New("need one reference sequence per segment to write a mutation-annotated tree")
+	}
+
+	// the state of every site on the path from the root to the current node, starting with the reference
+	current := make([]int, 0)
+	refNucs := make([]int, 0)
+	chromosomes := make([]int, 0) // the segment of each site
+	for i, segment := range segments {
+		if len(references[i]) != segment.Length {
+			return errors.New("the reference sequence for a mutation-annotated tree isn't the same length as the alignment (" +
+				strconv.Itoa(len(references[i])) + " vs " + strconv.Itoa(segment.Length) + ")")
+		}
+		for j, nuc := range strings.ToUpper(string(references[i])) {
+			code, ok := usherNucs[byte(nuc)]
+			if !ok {
+				return errors.New("the reference sequence for a mutation-annotated tree has an ambiguous nucleotide at site " + strconv.Itoa(j+1))
+			}
+			current = append(current, code)
+			refNucs = append(refNucs, code)
+			chromosomes = append(chromosomes, i)
+		}
+	}
+
+	nodeMutations := make([][]byte, 0)
+
+	// visit the nodes in preorder (the order UShER expects the mutation lists in), and build the newick string as we go
+	var walk func(cur, prev *tree.Node) string
+	walk = func(cur, prev *tree.Node) string {
+		id := cur.Id()
+
+		mutations := make([]byte, 0)
+		changed := make([]int, 0) // the sites that have mutations on this branch
+		parNucs := make([]int, 0)
+		for pos := range current {
+			setbits := bitsets.GetSetBits(states[id][pos : pos+1])
+			if len(setbits) != 1 || setbits[0]-1 == current[pos] {
+				continue
+			}
+			segment := segments[chromosomes[pos]]
+			m := matMutation{position: pos + 1 - segment.Offset, refNuc: refNucs[pos], parNuc: current[pos], mutNuc: setbits[0] - 1, chromosome: segment.Name}
+			mutations = appendBytesField(mutations, 1, m.encode())
+			current[pos] = m.mutNuc
+			changed = append(changed, pos)
+			parNucs = append(parNucs, m.parNuc)
+		}
+		nodeMutations = append(nodeMutations, mutations)
+
+		children := make([]string, 0)
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				children = append(children, walk(n, cur))
+			}
+		}
+
+		// and put the states back for this node's siblings
+		for i, pos := range changed {
+			current[pos] = parNucs[i]
+		}
+
+		s := cur.Name()
+		if len(children) > 0 {
+			s = "(" + strings.Join(children, ",") + ")" + s
+		}
+		if prev != nil {
+			s = s + ":" + strconv.Itoa(len(changed))
+		}
+		return s
+	}
+	newick := walk(t.Root(), nil) + ";"
+
+	data := appendBytesField(nil, 1, []byte(newick))
+	for _, mutations := range nodeMutations {
+		data = appendBytesField(data, 2, mutations)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(data)
+
+	return err
+}
+
+// ReadReferenceFasta reads the (first) sequence in a fasta file, e.g. the reference of a mutation-annotated tree
+func ReadReferenceFasta(fastaFile string) ([]byte, error) {
+	seq, err := readFastaRecord(fastaFile, "")
+	if err != nil {
+		return []byte{}, err
+	}
+	return []byte(seq), nil
+}
+
+// ReadMAT reads an UShER protobuf (.pb) mutation-annotated tree as the tree and the states of its tips at every site
+// of the reference. Each tip's sequence is the reference with the mutations on its path from the root applied.
+// Internal nodes are left with no states, for reconstructing. Condensed nodes (of identical tips) are expanded, so
+// the tips they stand for are siblings
+func ReadMAT(matFile string, reference []byte) (*tree.Tree, []CharacterStruct, []StartStop, [][]byte, error) {
+
+	b, err := os.ReadFile(matFile)
+	if err != nil {
+		return new(tree.Tree), []CharacterStruct{}, []StartStop{}, [][]byte{}, err
+	}
+
+	fields, err := readFields(b)
+	if err != nil {
+		return new(tree.Tree), []CharacterStruct{}, []StartStop{}, [][]byte{}, errors.New(matFile + ": " + err.Error())
+	}
+
+	var nwk string
+	mutationLists := make([][]byte, 0)
+	condensed := make(map[string][]string)
+	for _, f := range fields {
+		switch f.number {
+		case 1:
+			nwk = string(f.bytes)
+		case 2:
+			mutationLists = append(mutationLists, f.bytes)
+		case 3:
+			cfields, err := readFields(f.bytes)
+			if err != nil {
+				return new(tree.Tree), []CharacterStruct{}, []StartStop{}, [][]byte{}, errors.New(matFile + ": " + err.Error())
+			}
+			var name string
+			leaves := make([]string, 0)
+			for _, cf := range cfields {
+				switch cf.number {
+				case 1:
+					name = string(cf.bytes)
+				case 2:
+					leaves = append(leaves, string(cf.bytes))
+				}
+			}
+			condensed[name] = leaves
+		}
+	}
+
+	t, err := newick.NewParser(strings.NewReader(nwk)).Parse()
+	if err != nil {
+		return new(tree.Tree), []CharacterStruct{}, []StartStop{}, [][]byte{}, errors.New(matFile + ": " + err.Error())
+	}
+
+	// the newick parser numbers the nodes in preorder, which is the order of the mutation lists
+	nodes := t.Nodes()
+	if len(nodes) != len(mutationLists) {
+		return new(tree.Tree), []CharacterStruct{}, []StartStop{}, [][]byte{}, errors.New(matFile + ": the tree has " +
+			strconv.Itoa(len(nodes)) + " nodes but there are " + strconv.Itoa(len(mutationLists)) + " lists of mutations")
+	}
+
+	// expand the condensed nodes into their tips, which get the same states as the condensed node
+	nnodes := len(nodes)
+	sameAs := make(map[int]int)
+	for _, n := range nodes {
+		leaves, ok := condensed[n.Name()]
+		if !ok || !n.Tip() || len(leaves) == 0 {
+			continue
+		}
+		parent := n.Neigh()[0]
+		length := n.Edges()[0].Length()
+		n.SetName(leaves[0])
+		for _, leaf := range leaves[1:] {
+			newNode := t.NewNode()
+			newNode.SetName(leaf)
+			newNode.SetId(nnodes)
+			sameAs[nnodes] = n.Id()
+			nnodes++
+			e := t.ConnectNodes(parent, newNode)
+			e.SetLength(length)
+		}
+	}
+
+	lookup := makeNucByteLookup()
+	current := make([]byte, len(reference))
+	for i, nuc := range []byte(strings.ToUpper(string(reference))) {
+		current[i] = lookup[nuc]
+	}
+
+	states := make([][]byte, nnodes)
+	chromosome := ""
+
+	// apply the mutations from the root down, and keep the states at the tips
+	var walk func(cur, prev *tree.Node) error
+	walk = func(cur, prev *tree.Node) error {
+		id := cur.Id()
+
+		changed := make([]int, 0)
+		old := make([]byte, 0)
+		if id < len(mutationLists) {
+			mfields, err := readFields(mutationLists[id])
+			if err != nil {
+				return err
+			}
+			for _, mf := range mfields {
+				m, err := decodeMATMutation(mf.bytes)
+				if err != nil {
+					return err
+				}
+				if m.position < 1 || m.position > len(current) {
+					return errors.New("mutation at site " + strconv.Itoa(m.position) + " is outside the reference, which is " + strconv.Itoa(len(current)) + " long")
+				}
+				if len(m.chromosome) > 0 {
+					if len(chromosome) > 0 && m.chromosome != chromosome {
+						return errors.New("mutation-annotated trees with more than one chromosome aren't supported")
+					}
+					chromosome = m.chromosome
+				}
+				pos := m.position - 1
+				changed = append(changed, pos)
+				old = append(old, current[pos])
+				current[pos] = 0
+				for _, nuc := range m.mutNucs {
+					current[pos] |= lookup[nucStateKey[nuc][0]]
+				}
+			}
+		}
+
+		if cur.Tip() && prev != nil && id < len(mutationLists) {
+			states[id] = make([]byte, len(current))
+			copy(states[id], current)
+		}
+
+		for _, n := range cur.Neigh() {
+			if n != prev {
+				err := walk(n, cur)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for i := len(changed) - 1; i >= 0; i-- {
+			current[changed[i]] = old[i]
+		}
+
+		return nil
+	}
+	err = walk(t.Root(), nil)
+	if err != nil {
+		return new(tree.Tree), []CharacterStruct{}, []StartStop{}, [][]byte{}, errors.New(matFile + ": " + err.Error())
+	}
+
+	for id, other := range sameAs {
+		states[id] = make([]byte, len(states[other]))
+		copy(states[id], states[other])
+	}
+
+	fillEmptyStates(states, len(reference))
+
+	t.MaxDepthRooted(t.Root(), nil)
+	t.SortNeighborsByDepth(t.Root(), nil)
+	err = t.UpdateTipIndex()
+	if err != nil {
+		return new(tree.Tree), []CharacterStruct{}, []StartStop{}, [][]byte{}, err
+	}
+
+	characterStates := make([]CharacterStruct, len(reference))
+	for i := range characterStates {
+		characterStates[i].V = variant{vtype: "nuc", vpos: i + 1}
+		characterStates[i].Name, _ = getVariantName(characterStates[i].V)
+		characterStates[i].StateKey = nucStateKey
+	}
+
+	idx, _ := getIndex(characterStates)
+
+	return t, characterStates, idx, states, nil
+}
+
+// a mutation as read from a mutation-annotated tree. Tips can have more than one derived nucleotide, if they are
+// ambiguous
+type matReadMutation struct {
+	position   int
+	mutNucs    []int
+	chromosome string
+}
+
+func decodeMATMutation(b []byte) (matReadMutation, error) {
+	fields, err := readFields(b)
+	if err != nil {
+		return matReadMutation{}, err
+	}
+	m := matReadMutation{}
+	for _, f := range fields {
+		switch f.number {
+		case 1:
+			m.position = int(f.varint)
+		case 4:
+			nucs, err := f.varints()
+			if err != nil {
+				return matReadMutation{}, err
+			}
+			for _, nuc := range nucs {
+				if nuc > 3 {
+					return matReadMutation{}, errors.New("unknown nucleotide in mutation: " + strconv.Itoa(int(nuc)))
+				}
+				m.mutNucs = append(m.mutNucs, int(nuc))
+			}
+		case 5:
+			m.chromosome = string(f.bytes)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,153 @@
+package characterio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+// the sequence of every tip, by name
+func tipSequences(t *testing.T, matFile string, reference string) map[string]string {
+	tr, characters, _, states, err := ReadMAT(matFile, []byte(reference))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sequences := make(map[string]string)
+	for _, tip := range tr.Tips() {
+		seq := ""
+		for i, c := range characters {
+			seq = seq + strings.Join(stateNames(states[tip.Id()][i:i+1], c), "")
+		}
+		sequences[tip.Name()] = seq
+	}
+	return sequences
+}
+
+func Test_matMutationEncode(t *testing.T) {
+	tests := []struct {
+		m             matMutation
+		desiredResult []byte
+	}{
+		{matMutation{position: 5, refNuc: 0, parNuc: 0, mutNuc: 3}, []byte{0x08, 0x05, 0x10, 0x00, 0x18, 0x00, 0x22, 0x01, 0x03}},
+		// a position that takes two bytes as a varint, and a chromosome
+		{matMutation{position: 300, refNuc: 2, parNuc: 1, mutNuc: 0, chromosome: "S1"},
+			[]byte{0x08, 0xac, 0x02, 0x10, 0x02, 0x18, 0x01, 0x22, 0x01, 0x00, 0x2a, 0x02, 'S', '1'}},
+	}
+
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.m.encode(), test.desiredResult) {
+			t.Errorf("error in Test_matMutationEncode")
+		}
+	}
+}
+
+func Test_WriteMAT(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("((a:1,b:1):1,c:1);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the states of every node, in preorder: the root, the internal node, then a, b and c
+	reference := "ACGTAC"
+	sequences := []string{"ACGTAC", "ACGTTC", "GCGTTC", "ACGTTC", "ACCTAC"}
+	lookup := makeNucByteLookup()
+	states := make([][]byte, len(sequences))
+	for i, seq := range sequences {
+		for _, nuc := range []byte(seq) {
+			states[i] = append(states[i], lookup[nuc])
+		}
+	}
+
+	matFile := filepath.Join(t.TempDir(), "tree.pb")
+	err = WriteMAT(matFile, tr, states, []Segment{}, [][]byte{[]byte(reference)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(matFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// branch lengths are the number of mutations, and there is one (possibly empty) list of mutations per node
+	desiredResult := appendBytesField(nil, 1, []byte("((a:1,b:0):1,c:1);"))
+	for _, mutations := range [][]matMutation{
+		{},
+		{{position: 5, refNuc: 0, parNuc: 0, mutNuc: 3}},
+		{{position: 1, refNuc: 0, parNuc: 0, mutNuc: 2}},
+		{},
+		{{position: 3, refNuc: 2, parNuc: 2, mutNuc: 1}},
+	} {
+		node := make([]byte, 0)
+		for _, m := range mutations {
+			node = appendBytesField(node, 1, m.encode())
+		}
+		desiredResult = appendBytesField(desiredResult, 2, node)
+	}
+	if !reflect.DeepEqual(b, desiredResult) {
+		t.Errorf("error in Test_WriteMAT")
+	}
+
+	// and reading it back gives the tips' sequences
+	desiredSequences := map[string]string{"a": "GCGTTC", "b": "ACGTTC", "c": "ACCTAC"}
+	if !reflect.DeepEqual(tipSequences(t, matFile, reference), desiredSequences) {
+		t.Errorf("error in Test_WriteMAT")
+	}
+
+	err = WriteMAT(matFile, tr, states, []Segment{}, [][]byte{[]byte("ACGTA")})
+	if err == nil {
+		t.Errorf("error in Test_WriteMAT")
+	}
+}
+
+func Test_ReadMAT(t *testing.T) {
+	// a MAT as UShER writes it: one chromosome, clade annotations, and two identical tips condensed into one node
+	reference := "ACGTACGTAC"
+	sequences := tipSequences(t, "testdata/usher.pb", reference)
+	desiredResult := map[string]string{
+		"s1": "ACTTCCGTAC",
+		"s2": "ACTTACGTAC",
+		"s3": "ACTTACGTAC",
+		"s4": "AAGGACGTAC",
+	}
+	if !reflect.DeepEqual(sequences, desiredResult) {
+		t.Errorf("error in Test_ReadMAT")
+	}
+
+	// the condensed tips are siblings, below the node the condensed node was in
+	tr, _, _, _, err := ReadMAT("testdata/usher.pb", []byte(reference))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"s2", "s3"} {
+		id, err := tr.TipId(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		siblings := make([]string, 0)
+		for _, n := range tr.Nodes() {
+			if n.Id() != id {
+				continue
+			}
+			for _, child := range n.Neigh()[0].Neigh() {
+				if child.Tip() {
+					siblings = append(siblings, child.Name())
+				}
+			}
+		}
+		sort.Strings(siblings)
+		if !reflect.DeepEqual(siblings, []string{"s1", "s2", "s3"}) {
+			t.Errorf("error in Test_ReadMAT")
+		}
+	}
+
+	// mutations on two chromosomes
+	_, _, _, _, err = ReadMAT("testdata/twochromosomes.pb", []byte(reference))
+	if err == nil {
+		t.Errorf("error in Test_ReadMAT")
+	}
+}
@@ -90,7 +90,7 @@ func (p *Pair) set_order(m map[*tree.Edge][2]string) {
 // }
 
 // the tree's branches are labelled with "syn=" for non-protein-changing nucleotide changes,
-// and "AA=" for amino acid changes
+// and "AA=" for amino acid changes (after the segment's name, for multi-segment genomes)
 // edge.SynLen is also set to the inferred synonymous branch length
 func Epistasis(t *tree.Tree, features []annotation.Region, threads int) {
 	// the mean synonymous distance between non-synonymous pairs:
@@ -402,10 +402,10 @@ func get_temporally_unresolved(t *tree.Tree, p *Pair) (int, []*tree.Edge) {
 		i_present = false
 		j_present = false
 		for _, comment := range e.GetComments() {
-			if strings.HasPrefix(comment, "syn=") {
+			if isSyn(comment) {
 				continue
 			}
-			site = strings.Join(strings.Split(comment, ":")[0:2], ":")
+			site = aaSite(comment)
 			if site == i {
 				i_present = true
 			}
@@ -643,10 +643,10 @@ func ij_recur(prevEdge *tree.Edge, curNode *tree.Node, pair *Pair, open bool, sy
 		j_present := false
 		var site string
 		for _, comment := range e.GetComments() {
-			if strings.HasPrefix(comment, "syn=") {
+			if isSyn(comment) {
 				continue
 			}
-			site = strings.Join(strings.Split(comment, ":")[0:2], ":")
+			site = aaSite(comment)
 			if site == i {
 				i_present = true
 			}
@@ -728,10 +728,10 @@ func ij_recur_unresolved(prevEdge *tree.Edge, curNode *tree.Node, pair *Pair, op
 		j_present := false
 		var site string
 		for _, comment := range e.GetComments() {
-			if strings.HasPrefix(comment, "syn=") {
+			if isSyn(comment) {
 				continue
 			}
-			site = strings.Join(strings.Split(comment, ":")[0:2], ":")
+			site = aaSite(comment)
 			if site == i {
 				i_present = true
 			}
@@ -825,3 +825,17 @@ func printResults(cResultsIn chan Pair, cWriteDone chan bool) {
 
 	cWriteDone <- true
 }
+
+// whether a branch label is a non-protein-changing nucleotide change, e.g. syn=A5G or seg4:syn=A5G
+func isSyn(comment string) bool {
+	return strings.Contains(comment, "syn=")
+}
+
+// the amino acid site of a branch label, e.g. AA=S:501 from AA=S:501:NY, or seg4:AA=HA:160 from seg4:AA=HA:160:TK
+func aaSite(comment string) string {
+	i := strings.Index(comment, "AA=")
+	if i == -1 {
+		i = 0
+	}
+	return comment[:i] + strings.Join(strings.Split(comment[i:], ":")[0:2], ":")
+}
@@ -30,8 +30,7 @@ func getMutSpectrum(t *tree.Tree) map[string]int {
 
 	for _, e := range t.Edges() {
 		for _, c := range e.GetComments() {
-			temp := strings.Split(c, "=")[1]
-			temp = strings.Split(temp, ",")[0]
+			_, temp := splitLabel(c)
 			if _, ok := m[temp]; ok {
 				m[temp]++
 			}
@@ -67,8 +66,7 @@ func getSynNonsynMutSpectrum(t *tree.Tree) map[string]map[string]int {
 
 	for _, e := range t.Edges() {
 		for _, c := range e.GetComments() {
-			SorN := strings.Split(c, "=")[0]
-			trans := strings.Split(c, "=")[1]
+			SorN, trans := splitLabel(c)
 			if _, ok := m[trans][SorN]; ok {
 				m[trans][SorN]++
 			}
@@ -77,3 +75,15 @@ func getSynNonsynMutSpectrum(t *tree.Tree) map[string]map[string]int {
 
 	return m
 }
+
+// the kind (syn or nonSyn) and nucleotide change (e.g. A->G) of a branch label, without its segment's name or the
+// features it is in, e.g. syn and A->G from seg4:syn=UTR:A->G
+func splitLabel(c string) (string, string) {
+	kv := strings.SplitN(c, "=", 2)
+	if len(kv) != 2 {
+		return "", ""
+	}
+	kind := kv[0][strings.LastIndex(kv[0], ":")+1:]
+	change := kv[1][strings.LastIndex(kv[1], ":")+1:]
+	return kind, strings.Split(change, ",")[0]
+}
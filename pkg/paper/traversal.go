@@ -4,8 +4,6 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/cov-ert/gofasta/pkg/alphabet"
-
 	"github.com/benjamincjackson/ash/pkg/annotation"
 	"github.com/benjamincjackson/ash/pkg/bitsets"
 	"github.com/benjamincjackson/ash/pkg/characterio"
@@ -40,7 +38,11 @@ func labelEdgeSynNonsyn(upnode, downnode *tree.Node, edge *tree.Edge, regions []
 	down_id := downnode.Id()
 
 	IUPACMap := annotation.GetIUPACMap()
-	codonDict := alphabet.MakeCodonDict()
+
+	// CDSs can overlap, so we classify the changes in CDSs in every frame before we label them
+	changes := make(annotation.SiteChanges)
+	// and the segment prefix of each changed site's labels
+	prefixes := make(map[int]string)
 
 	// the characters are all nucleotides so we don't need the idx of states
 	// instead we use the regions slice to annotate things
@@ -82,7 +84,7 @@ func labelEdgeSynNonsyn(upnode, downnode *tree.Node, edge *tree.Edge, regions []
 					der := strings.Join(downstate, "|")
 					// trans := anc + "->" + der
 					// number := getTransitionNumber(transitions[i], trans)
-					label := "syn=" + anc + "->" + der
+					label := region.LabelPrefix() + "syn=" + region.FeaturePrefix(pos+1) + anc + "->" + der
 					edge.AddComment(label)
 
 					// Skipping this for now (means we can't summarise things). To do: re-implement this
@@ -92,23 +94,34 @@ func labelEdgeSynNonsyn(upnode, downnode *tree.Node, edge *tree.Edge, regions []
 				}
 			}
 		case "CDS":
+			// this CDS's genetic code
+			codonDict := annotation.CodonDict(region.TranslTable)
+
 			// 1-based position of amino acid in this CDS:
 			AACounter := 1
 
 			// for every codon in this CDS:
-			for _, codonstart := range region.Codonstarts {
-				// if the bitsets for each codon's (three nucleotides') states are different:
-				if bitsets.Different(states[up_id][codonstart-1:codonstart+2], states[down_id][codonstart-1:codonstart+2]) {
+			for _, codon := range region.Codons {
+				// if the bitsets for any of each codon's (three nucleotides') states are different:
+				different := false
+				for _, site := range codon {
+					if bitsets.Different(states[up_id][site-1:site], states[down_id][site-1:site]) {
+						different = true
+					}
+				}
+				if different {
 					// then we need to get the nucleotides and attempt to translate them
 					nuclabels := make([]string, 0)
+					nucsites := make([]int, 0)
 
 					upcodon := ""
 					downcodon := ""
 
-					// nucleotide position:
-					pos := codonstart - 1
+					// the codon's sites, in reading order:
+					for _, site := range codon {
 
-					for i := 0; i < 3; i++ {
+						// nucleotide position:
+						pos := site - 1
 
 						// the set bits for this character
 						upstatebits := bitsets.GetSetBits(states[up_id][pos : pos+1])
@@ -164,11 +177,17 @@ func labelEdgeSynNonsyn(upnode, downnode *tree.Node, edge *tree.Edge, regions []
 								continue
 							}
 
-							label := anc + "->" + der
+							label := region.FeaturePrefix(pos+1) + anc + "->" + der
 							nuclabels = append(nuclabels, label)
+							nucsites = append(nucsites, pos)
+							prefixes[pos] = region.LabelPrefix()
 						}
-						// increment the nucleotide position:
-						pos++
+					}
+
+					// CDSs on the minus strand are read from the complement of their sites
+					if region.Complement {
+						upcodon = annotation.Complement(upcodon)
+						downcodon = annotation.Complement(downcodon)
 					}
 
 					var upAA string
@@ -195,23 +214,24 @@ func labelEdgeSynNonsyn(upnode, downnode *tree.Node, edge *tree.Edge, regions []
 						DifferentAAs := upAA != downAA
 						switch DifferentAAs {
 
-						// They are different. if there is only one nuc change, we label it
+						// They are different. if there is only one nuc change, we classify it
 						case true:
 							if len(nuclabels) == 1 {
-								label := "nonSyn=" + nuclabels[0]
-								edge.AddComment(label)
+								changes.Add(nucsites[0], nuclabels[0], "nonsyn")
 							}
 
-						// They are the same. if there is only one nuc change, we label it
+						// They are the same. if there is only one nuc change, we classify it
 						case false:
 							if len(nuclabels) == 1 {
-								label := "syn=" + nuclabels[0]
-								edge.AddComment(label)
+								changes.Add(nucsites[0], nuclabels[0], "syn")
 							}
 						}
 
-					// if we can't, then we do nothing
+					// if we can't, then we do nothing (but we remember that we couldn't in this frame)
 					case false:
+						if len(nuclabels) == 1 {
+							changes.Add(nucsites[0], nuclabels[0], "unresolved")
+						}
 					}
 				}
 
@@ -219,4 +239,16 @@ func labelEdgeSynNonsyn(upnode, downnode *tree.Node, edge *tree.Edge, regions []
 			}
 		}
 	}
+
+	// then we label each nucleotide change in a CDS once: as nonsynonymous if it changes the amino acid
+	// in any frame, or as synonymous if it is synonymous in every frame
+	for _, pos := range changes.Sites() {
+		c := changes[pos]
+		switch {
+		case c.NonSyn > 0:
+			edge.AddComment(prefixes[pos] + "nonSyn=" + c.Label)
+		case c.Synonymous():
+			edge.AddComment(prefixes[pos] + "syn=" + c.Label)
+		}
+	}
 }
@@ -5,8 +5,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/cov-ert/gofasta/pkg/alphabet"
-
 	"github.com/benjamincjackson/ash/pkg/annotation"
 	"github.com/benjamincjackson/ash/pkg/bitsets"
 	"github.com/benjamincjackson/ash/pkg/characterio"
@@ -127,7 +125,10 @@ func labelEdgeAnno(upnode, downnode *tree.Node, edge *tree.Edge, regions []annot
 	down_id := downnode.Id()
 
 	IUPACMap := annotation.GetIUPACMap()
-	codonDict := alphabet.MakeCodonDict()
+
+	// CDSs can overlap, so we classify the changes in CDSs in every frame before we label them
+	changes := make(annotation.SiteChanges)
+	aalabels := make(map[string]bool)
 
 	// the characters are all nucleotides so we don't need the idx of states
 	// instead we use the regions slice to annotate things
@@ -169,7 +170,7 @@ func labelEdgeAnno(upnode, downnode *tree.Node, edge *tree.Edge, regions []annot
 					der := strings.Join(downstate, "|")
 					// trans := anc + "->" + der
 					// number := getTransitionNumber(transitions[i], trans)
-					label := "nuc=" + anc + strconv.Itoa(pos+1) + der
+					label := region.LabelPrefix() + "nuc=" + region.FeaturePrefix(pos+1) + anc + strconv.Itoa(pos+1-region.Offset) + der
 					edge.AddComment(label)
 					// and increment the synonymous branch length
 					edge.SynLen++
@@ -180,23 +181,34 @@ func labelEdgeAnno(upnode, downnode *tree.Node, edge *tree.Edge, regions []annot
 				}
 			}
 		case "CDS":
+			// this CDS's genetic code
+			codonDict := annotation.CodonDict(region.TranslTable)
+
 			// 1-based position of amino acid in this CDS:
 			AACounter := 1
 
 			// for every codon in this CDS:
-			for _, codonstart := range region.Codonstarts {
-				// if the bitsets for each codon's (three nucleotides') states are different:
-				if bitsets.Different(states[up_id][codonstart-1:codonstart+2], states[down_id][codonstart-1:codonstart+2]) {
+			for _, codon := range region.Codons {
+				// if the bitsets for any of each codon's (three nucleotides') states are different:
+				different := false
+				for _, site := range codon {
+					if bitsets.Different(states[up_id][site-1:site], states[down_id][site-1:site]) {
+						different = true
+					}
+				}
+				if different {
 					// then we need to get the nucleotides and attempt to translate them
 					nuclabels := make([]string, 0)
+					nucsites := make([]int, 0)
 
 					upcodon := ""
 					downcodon := ""
 
-					// nucleotide position:
-					pos := codonstart - 1
+					// the codon's sites, in reading order:
+					for _, site := range codon {
 
-					for i := 0; i < 3; i++ {
+						// nucleotide position:
+						pos := site - 1
 
 						// the set bits for this character
 						upstatebits := bitsets.GetSetBits(states[up_id][pos : pos+1])
@@ -252,11 +264,16 @@ func labelEdgeAnno(upnode, downnode *tree.Node, edge *tree.Edge, regions []annot
 								continue
 							}
 
-							label := "nuc=" + anc + strconv.Itoa(pos+1) + der
+							label := region.LabelPrefix() + "nuc=" + region.FeaturePrefix(pos+1) + anc + strconv.Itoa(pos+1-region.Offset) + der
 							nuclabels = append(nuclabels, label)
+							nucsites = append(nucsites, pos)
 						}
-						// increment the nucleotide position:
-						pos++
+					}
+
+					// CDSs on the minus strand are read from the complement of their sites
+					if region.Complement {
+						upcodon = annotation.Complement(upcodon)
+						downcodon = annotation.Complement(downcodon)
 					}
 
 					var upAA string
@@ -283,24 +300,30 @@ func labelEdgeAnno(upnode, downnode *tree.Node, edge *tree.Edge, regions []annot
 						DifferentAAs := upAA != downAA
 						switch DifferentAAs {
 
-						// They are different. We label the edge with the AA change, we don't label any SNPs
+						// They are different. We label the edge with the AA change, we don't label any SNPs (in this frame)
 						case true:
-							label := "AA=" + region.Name + ":" + upAA + strconv.Itoa(AACounter) + downAA
-							edge.AddComment(label)
+							name, residue := region.Residue(AACounter)
+							label := region.LabelPrefix() + "AA=" + name + ":" + upAA + strconv.Itoa(residue) + downAA
+							// (a mature peptide can be in more than one polyprotein, so we might have labelled it already)
+							if !aalabels[label] {
+								edge.AddComment(label)
+								aalabels[label] = true
+							}
+							for i := range nuclabels {
+								changes.Add(nucsites[i], nuclabels[i], "nonsyn")
+							}
 
-						// They are the same. We label the edge with any nucleotide changes that there are
+						// They are the same. Any nucleotide changes that there are are synonymous (in this frame)
 						case false:
-							for _, label := range nuclabels {
-								edge.AddComment(label)
-								// and increment the synonymous branch length
-								edge.SynLen++
+							for i := range nuclabels {
+								changes.Add(nucsites[i], nuclabels[i], "syn")
 							}
 						}
 
 					// if we can't, then we want to record the SNPs (SOMETHING FOR LATER- do we want to call them synonymous?)
 					case false:
-						for _, label := range nuclabels {
-							edge.AddComment(label)
+						for i := range nuclabels {
+							changes.Add(nucsites[i], nuclabels[i], "unresolved")
 						}
 					}
 				}
@@ -309,6 +332,18 @@ func labelEdgeAnno(upnode, downnode *tree.Node, edge *tree.Edge, regions []annot
 			}
 		}
 	}
+
+	// then we label each nucleotide change in a CDS once, if it isn't amino acid changing in at least one frame,
+	// and increment the synonymous branch length if it is synonymous in every frame
+	for _, pos := range changes.Sites() {
+		c := changes[pos]
+		if c.Syn+c.Unresolved > 0 {
+			edge.AddComment(c.Label)
+		}
+		if c.Synonymous() {
+			edge.SynLen++
+		}
+	}
 }
 
 func getTransitionNumber(ta []characterio.Transition, label string) int {
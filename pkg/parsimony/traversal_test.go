@@ -0,0 +1,100 @@
+package parsimony
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benjamincjackson/ash/pkg/annotation"
+	"github.com/benjamincjackson/ash/pkg/characterio"
+	"github.com/benjamincjackson/gotree/newick"
+)
+
+func Test_LabelChangesAnno(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("(a,b);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// G1 is ATG GAA (ME), and G2 overlaps it in another frame: GGA (G). a's A5G changes G1's E2 to G but is
+	// synonymous in G2, and b's A6G is synonymous in G1 (the only frame it is in)
+	regions := []annotation.Region{
+		{Whichtype: "CDS", Name: "G1", Start: 1, Stop: 6, Codons: [][3]int{{1, 2, 3}, {4, 5, 6}}, TranslTable: 1},
+		{Whichtype: "CDS", Name: "G2", Start: 3, Stop: 5, Codons: [][3]int{{3, 4, 5}}, TranslTable: 1},
+	}
+	characters := make([]characterio.CharacterStruct, 6)
+	for i := range characters {
+		characters[i].StateKey = []string{"A", "C", "G", "T"}
+	}
+	states := [][]byte{
+		{128, 16, 32, 32, 128, 128}, // the root: ATGGAA
+		{128, 16, 32, 32, 32, 128},  // a: ATGGGA
+		{128, 16, 32, 32, 128, 32},  // b: ATGGAG
+	}
+
+	LabelChangesAnno(tr, regions, characters, states)
+
+	tests := []struct {
+		tip           string
+		desiredResult []string
+		synLen        float64
+	}{
+		{"a", []string{"AA=G1:E2G", "nuc=A5G"}, 0},
+		{"b", []string{"nuc=A6G"}, 1},
+	}
+
+	for _, test := range tests {
+		for _, e := range tr.Root().Edges() {
+			if e.Right().Name() != test.tip {
+				continue
+			}
+			if !reflect.DeepEqual(e.GetComments(), test.desiredResult) || e.SynLen != test.synLen {
+				t.Errorf("error in Test_LabelChangesAnno")
+			}
+		}
+	}
+}
+
+func Test_LabelChangesAnnoSpliced(t *testing.T) {
+	tr, err := newick.NewParser(strings.NewReader("(a,b);")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// G3 is on the minus strand, and its one codon spans an intron: it is the complement of sites 6, 5 and 2, which
+	// is TTA (L) at the root. a's A5G makes it TCA (S), and b's A6G makes it CTA (L)
+	regions := []annotation.Region{
+		{Whichtype: "CDS", Name: "G3", Start: 2, Stop: 6, Codons: [][3]int{{6, 5, 2}}, TranslTable: 1, Complement: true},
+	}
+	characters := make([]characterio.CharacterStruct, 6)
+	for i := range characters {
+		characters[i].StateKey = []string{"A", "C", "G", "T"}
+	}
+	states := [][]byte{
+		{128, 16, 32, 32, 128, 128}, // the root: ATGGAA
+		{128, 16, 32, 32, 32, 128},  // a: ATGGGA
+		{128, 16, 32, 32, 128, 32},  // b: ATGGAG
+	}
+
+	LabelChangesAnno(tr, regions, characters, states)
+
+	tests := []struct {
+		tip           string
+		desiredResult []string
+		synLen        float64
+	}{
+		{"a", []string{"AA=G3:L1S"}, 0},
+		{"b", []string{"nuc=A6G"}, 1},
+	}
+
+	for _, test := range tests {
+		for _, e := range tr.Root().Edges() {
+			if e.Right().Name() != test.tip {
+				continue
+			}
+			if !reflect.DeepEqual(e.GetComments(), test.desiredResult) || e.SynLen != test.synLen {
+				t.Errorf("error in Test_LabelChangesAnnoSpliced")
+			}
+		}
+	}
+}